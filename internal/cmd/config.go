@@ -3,19 +3,80 @@ package cmd
 import (
 	"flag"
 	"fmt"
+	"log/slog"
+	"strings"
+	"time"
 
+	"github.com/fhofherr/rsched/internal/restic"
 	"github.com/peterbourgon/ff/v3"
 )
 
+// DefaultCatchUpWindow is the default value of Config.CatchUpWindow.
+const DefaultCatchUpWindow = 24 * time.Hour
+
 // Config contains the configuration for the rsched command. The individual
 // values can be either set using command line flags or environment variables.
+//
+// Additionally jobs can be defined in a config file passed using the -config
+// flag. The values of all job related flags are ignored in this case.
 type Config struct {
-	PrintVersion       bool
-	BackupPath         string
-	BackupSchedule     string
+	PrintVersion bool
+	ConfigFile   string
+	HTTPAddress  string
+	LogLevel     slog.Level
+	LogFormat    string
+
+	// ShutdownTimeout is the maximum time rsched waits for running jobs
+	// during shutdown. Waits indefinitely if zero.
+	ShutdownTimeout time.Duration
+
+	// StateFile is the file the state of all jobs is persisted to. Disabled
+	// if empty.
+	StateFile string
+
+	// CatchUpWindow is the maximum time since a missed run of a job for it
+	// to be caught up after rsched starts. Disabled if zero.
+	CatchUpWindow time.Duration
+
+	// HealthMaxBackupAge is the maximum time since the last backup of any
+	// job before rsched reports itself as unhealthy. Disabled if zero.
+	HealthMaxBackupAge time.Duration
+
+	Jobs           []JobConfig
+	BackupPaths    []string
+	BackupSchedule string
+
+	Retry           restic.RetryPolicy
+	JobTimeout      time.Duration
+	KillGracePeriod time.Duration
+	OverlapPolicy   restic.OverlapPolicy
+	TimeZone        string
+	StartDelay      restic.StartDelay
+	Windows         restic.Windows
+
+	BackupExcludes          []string
+	BackupExcludeFiles      []string
+	BackupIExcludes         []string
+	BackupExcludeCaches     bool
+	BackupExcludeIfPresent  []string
+	BackupExcludeLargerThan string
+	BackupOneFileSystem     bool
+	BackupInitPolicy        restic.InitPolicy
+
 	ResticPasswordFile string
 	ResticRepository   string
 	ResticBinary       string
+	ForgetSchedule     string
+	ForgetPolicy       restic.ForgetPolicy
+	PruneSchedule      string
+	PruneMaxUnused     string
+	PruneMaxRepackSize string
+	CheckSchedule      string
+	CheckSubsets       int
+	DrillSchedule      string
+	DrillSampleSize    int
+	DrillVerification  restic.DrillVerification
+	DrillScratchDir    string
 }
 
 // LoadConfig loads a new Config from the environment and command line flags.
@@ -24,8 +85,223 @@ func LoadConfig(args []string) (Config, error) {
 
 	fs := flag.NewFlagSet("rsched", flag.ContinueOnError)
 	fs.BoolVar(&cfg.PrintVersion, "v", false, "Print version and exit")
+	fs.StringVar(
+		&cfg.ConfigFile,
+		"config",
+		"",
+		`Path to a YAML file defining the jobs to schedule.
+
+If this is set all job related flags are ignored.
+`)
+	fs.TextVar(
+		&cfg.LogLevel,
+		"log-level",
+		slog.LevelInfo,
+		"Minimum level of log messages: DEBUG, INFO, WARN, or ERROR.",
+	)
+	fs.StringVar(&cfg.LogFormat, "log-format", LogFormatText, `Format of log messages. Either "text" or "json".`)
+	fs.StringVar(
+		&cfg.HTTPAddress,
+		"http-address",
+		"",
+		`Address to listen on for HTTP requests, e.g. :8080.
+
+Prometheus metrics are exposed at /metrics. Health checks are exposed at
+/healthz and /readyz. The HTTP listener is disabled if this is empty.
+`)
+	fs.DurationVar(
+		&cfg.ShutdownTimeout,
+		"shutdown-timeout",
+		0,
+		`Maximum time to wait for running jobs during shutdown, e.g. 1m.
+
+Restic is killed once the timeout expires. Should be longer than
+-kill-grace-period. rsched waits indefinitely if this is 0. A second
+SIGINT or SIGTERM always kills restic and terminates rsched immediately.
+`)
+	fs.StringVar(
+		&cfg.StateFile,
+		"state-file",
+		"",
+		`File the start and result of each job are persisted to, e.g.
+/var/lib/rsched/state.json.
+
+rsched uses the file to catch up on runs missed while it was not
+running. Disabled if this is empty.
+`)
+	fs.DurationVar(
+		&cfg.CatchUpWindow,
+		"catch-up-window",
+		DefaultCatchUpWindow,
+		`Maximum time since a missed run of a job for it to be caught up once
+rsched starts. Jobs which missed a run within the window since their
+last success run immediately.
+
+Requires -state-file. Disabled if this is 0.
+`)
+	fs.DurationVar(
+		&cfg.HealthMaxBackupAge,
+		"health-max-backup-age",
+		0,
+		`Report rsched as unhealthy if the last backup of any job is older than
+this, e.g. 25h. Jobs without any backup are reported as unhealthy once this
+passed since rsched started.
+
+Disabled if this is 0.
+`)
+	fs.DurationVar(
+		&cfg.JobTimeout,
+		"job-timeout",
+		0,
+		`Maximum duration of a single attempt of any job, e.g. 6h.
+
+Restic is interrupted if the job takes longer. Disabled if this is 0.
+`)
+	fs.DurationVar(
+		&cfg.KillGracePeriod,
+		"kill-grace-period",
+		restic.DefaultKillGracePeriod,
+		`Time restic gets to exit after it was interrupted, e.g. because of a
+timeout or a shutdown. Restic and all its child processes are killed
+afterwards.
+`)
+	fs.Var(
+		&cfg.OverlapPolicy,
+		"overlap-policy",
+		`Behavior if a job becomes due while its previous run is still in
+progress. Either "queue", "skip", or "concurrent".
+
+"queue" runs the job once more after the previous run completed. "skip"
+skips the run. "concurrent" queues the run like "queue" but does not wait
+for jobs targeting a different repository.
+`)
+	fs.StringVar(
+		&cfg.TimeZone,
+		"time-zone",
+		"",
+		`Time zone all schedules are evaluated in, e.g. Europe/Berlin.
+
+Defaults to the local time zone. A CRON_TZ= prefix of a schedule takes
+precedence.
+`)
+	fs.DurationVar(
+		&cfg.StartDelay.Max,
+		"start-delay",
+		0,
+		`Maximum delay of the start of each run of any job, e.g. 10m.
+
+Spreads the runs of many hosts using the same schedule and storage
+backend. The delay is chosen randomly for each run. Disabled if this
+is 0.
+`)
+	fs.BoolVar(
+		&cfg.StartDelay.Deterministic,
+		"start-delay-deterministic",
+		false,
+		"Derive the start delay from a hash of the host name and the job name instead of choosing it randomly.",
+	)
+	fs.Var(
+		&cfg.Windows.Allowed,
+		"allowed-window",
+		`Window jobs are allowed to run in. May be passed multiple times.
+
+Either days and a time range, e.g. "mon-fri 22:00-06:00", or an absolute
+range of RFC 3339 timestamps separated by a slash. Jobs run at any time
+if no allowed window is set.
+`)
+	fs.Var(
+		&cfg.Windows.Blocked,
+		"blocked-window",
+		`Window jobs must not run in, e.g. "mon-fri 08:00-18:00". May be
+passed multiple times. Uses the same format as -allowed-window.
+`)
+	fs.BoolVar(
+		&cfg.Windows.Defer,
+		"defer-blocked-runs",
+		false,
+		"Defer runs which are not allowed by the windows until the next allowed time instead of skipping them.",
+	)
+	fs.IntVar(
+		&cfg.Retry.MaxAttempts,
+		"retry-max-attempts",
+		0,
+		`Maximum number of attempts of a failed job, including the first one.
+
+Only failures caused by a locked repository or an unreachable backend are
+retried. Retries are disabled if this is less than 2.
+`)
+	fs.DurationVar(
+		&cfg.Retry.InitialBackoff,
+		"retry-initial-backoff",
+		restic.DefaultInitialBackoff,
+		"Delay before the first retry. The delay doubles with every further retry.",
+	)
+	fs.DurationVar(
+		&cfg.Retry.MaxBackoff,
+		"retry-max-backoff",
+		restic.DefaultMaxBackoff,
+		"Maximum delay between retries.",
+	)
+	fs.Float64Var(
+		&cfg.Retry.Jitter,
+		"retry-jitter",
+		0,
+		"Randomly change the delay between retries by up to this fraction, e.g. 0.2.",
+	)
 	fs.StringVar(&cfg.BackupSchedule, "backup-schedule", "@hourly", "Interval in which backups should be taken.")
-	fs.StringVar(&cfg.BackupPath, "restic-backup-path", "/", "Directory to backup.")
+	fs.Var(
+		(*stringSlice)(&cfg.BackupPaths),
+		"restic-backup-path",
+		"Directory to backup. May be passed multiple times. Defaults to /.",
+	)
+	fs.Var(
+		(*stringSlice)(&cfg.BackupExcludes),
+		"backup-exclude",
+		"Exclude files matching the pattern from the backup. May be passed multiple times.",
+	)
+	fs.Var(
+		(*stringSlice)(&cfg.BackupExcludeFiles),
+		"backup-exclude-file",
+		"Read exclude patterns from the file. May be passed multiple times.",
+	)
+	fs.Var(
+		(*stringSlice)(&cfg.BackupIExcludes),
+		"backup-iexclude",
+		"Like -backup-exclude but ignores the case of paths. May be passed multiple times.",
+	)
+	fs.BoolVar(
+		&cfg.BackupExcludeCaches,
+		"backup-exclude-caches",
+		false,
+		"Exclude directories containing a CACHEDIR.TAG file from the backup.",
+	)
+	fs.Var(
+		(*stringSlice)(&cfg.BackupExcludeIfPresent),
+		"backup-exclude-if-present",
+		"Exclude directories containing a file with the passed name. May be passed multiple times.",
+	)
+	fs.StringVar(
+		&cfg.BackupExcludeLargerThan,
+		"backup-exclude-larger-than",
+		"",
+		"Exclude files larger than the passed size, e.g. 1G, from the backup.",
+	)
+	fs.BoolVar(
+		&cfg.BackupOneFileSystem,
+		"backup-one-file-system",
+		false,
+		"Do not cross file system boundaries during the backup.",
+	)
+	fs.Var(
+		&cfg.BackupInitPolicy,
+		"backup-init-policy",
+		`Initialization of the restic repository. Either "if-missing", "never",
+or "always-check".
+
+"if-missing" initializes the repository if restic reports that it does
+not exist. "never" neither checks nor initializes the repository.
+"always-check" aborts the backup if the repository does not exist.
+`)
 	fs.StringVar(
 		&cfg.ResticPasswordFile,
 		"restic-password-file",
@@ -50,10 +326,194 @@ variable is set.
 
 	fs.StringVar(&cfg.ResticBinary, "restic-binary", "", "Path to the restic binary")
 
+	fs.StringVar(
+		&cfg.ForgetSchedule,
+		"forget-schedule",
+		"",
+		`Interval in which old snapshots should be forgotten.
+
+Forgetting snapshots is disabled if this is empty. At least one of the
+-forget-keep-* flags needs to be passed if this is set.
+`)
+	fs.IntVar(&cfg.ForgetPolicy.KeepLast, "forget-keep-last", 0, "Keep the last n snapshots.")
+	fs.IntVar(&cfg.ForgetPolicy.KeepHourly, "forget-keep-hourly", 0, "Keep the last n hourly snapshots.")
+	fs.IntVar(&cfg.ForgetPolicy.KeepDaily, "forget-keep-daily", 0, "Keep the last n daily snapshots.")
+	fs.IntVar(&cfg.ForgetPolicy.KeepWeekly, "forget-keep-weekly", 0, "Keep the last n weekly snapshots.")
+	fs.IntVar(&cfg.ForgetPolicy.KeepMonthly, "forget-keep-monthly", 0, "Keep the last n monthly snapshots.")
+	fs.IntVar(&cfg.ForgetPolicy.KeepYearly, "forget-keep-yearly", 0, "Keep the last n yearly snapshots.")
+	fs.StringVar(
+		&cfg.ForgetPolicy.KeepWithin,
+		"forget-keep-within",
+		"",
+		"Keep snapshots newer than the passed duration, e.g. 1y5m7d2h.",
+	)
+	fs.Var(
+		(*stringSlice)(&cfg.ForgetPolicy.KeepTags),
+		"forget-keep-tag",
+		"Keep snapshots with this tag. May be passed multiple times.",
+	)
+
+	fs.StringVar(
+		&cfg.PruneSchedule,
+		"prune-schedule",
+		"",
+		`Interval in which unreferenced data should be removed from the repository.
+
+Pruning is disabled if this is empty.
+`)
+	fs.StringVar(
+		&cfg.PruneMaxUnused,
+		"prune-max-unused",
+		"",
+		"Tolerate the passed amount of unused data in the repository, e.g. 5% or 2G.",
+	)
+	fs.StringVar(
+		&cfg.PruneMaxRepackSize,
+		"prune-max-repack-size",
+		"",
+		"Maximum amount of data repacked during a single prune, e.g. 2G.",
+	)
+
+	fs.StringVar(
+		&cfg.CheckSchedule,
+		"check-schedule",
+		"",
+		`Interval in which the integrity of the repository should be checked.
+
+Checking the repository is disabled if this is empty.
+`)
+	fs.IntVar(
+		&cfg.CheckSubsets,
+		"check-read-data-subsets",
+		0,
+		`Split the data in the repository into n subsets and read and verify
+the next subset on every check.
+
+Only the structure of the repository is checked if this is 0.
+`)
+
+	fs.StringVar(
+		&cfg.DrillSchedule,
+		"restore-drill-schedule",
+		"",
+		`Interval in which the latest snapshot should be restored and verified.
+
+Only snapshots of -restic-backup-path created on this host are restored.
+Restore drills are disabled if this is empty.
+`)
+	fs.IntVar(
+		&cfg.DrillSampleSize,
+		"restore-drill-sample-size",
+		0,
+		"Restore a random sample of n files instead of the whole snapshot.",
+	)
+	fs.Var(
+		&cfg.DrillVerification,
+		"restore-drill-verification",
+		`Verification of restored files. Either "repository" or "live".
+
+"repository" lets restic verify the restored files against the repository.
+"live" compares restored files with unmodified live files.
+`)
+	fs.StringVar(
+		&cfg.DrillScratchDir,
+		"restore-drill-scratch-dir",
+		"",
+		`Directory snapshots are restored into during a restore drill.
+
+The directory is removed after each drill. A temporary directory is used
+if this is empty.
+`)
+
 	err := ff.Parse(fs, args, ff.WithEnvVarPrefix("RSCHED"))
 	if err != nil {
 		return cfg, fmt.Errorf("parse config: %v", err)
 	}
+	if cfg.LogFormat != LogFormatText && cfg.LogFormat != LogFormatJSON {
+		return cfg, fmt.Errorf("parse config: unknown log format: %q", cfg.LogFormat)
+	}
+	if cfg.TimeZone != "" {
+		if _, err := time.LoadLocation(cfg.TimeZone); err != nil {
+			return cfg, fmt.Errorf("parse config: time zone: %v", err)
+		}
+	}
+	if len(cfg.BackupPaths) == 0 {
+		cfg.BackupPaths = []string{"/"}
+	}
+	if cfg.ConfigFile != "" {
+		jobs, err := loadJobs(cfg.ConfigFile)
+		if err != nil {
+			return cfg, fmt.Errorf("parse config: %v", err)
+		}
+		cfg.Jobs = jobs
+	}
 
 	return cfg, nil
 }
+
+// stringSlice is a flag.Value which collects all values passed for a flag.
+type stringSlice []string
+
+func (s *stringSlice) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringSlice) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// implicitJob creates the job defined by the command line flags.
+//
+// The restic repository and password file are only taken from the flags if
+// the respective environment variable is not set in env.
+func (c Config) implicitJob(env map[string]string) JobConfig {
+	job := JobConfig{
+		Name:            DefaultJobName,
+		Retry:           c.Retry,
+		Timeout:         c.JobTimeout,
+		KillGracePeriod: c.KillGracePeriod,
+		Overlap:         c.OverlapPolicy,
+		TimeZone:        c.TimeZone,
+		StartDelay:      c.StartDelay,
+		Windows:         c.Windows,
+		Backup: BackupConfig{
+			Schedule:          c.BackupSchedule,
+			Paths:             c.BackupPaths,
+			Excludes:          c.BackupExcludes,
+			ExcludeFiles:      c.BackupExcludeFiles,
+			IExcludes:         c.BackupIExcludes,
+			ExcludeCaches:     c.BackupExcludeCaches,
+			ExcludeIfPresent:  c.BackupExcludeIfPresent,
+			ExcludeLargerThan: c.BackupExcludeLargerThan,
+			OneFileSystem:     c.BackupOneFileSystem,
+			InitPolicy:        c.BackupInitPolicy,
+		},
+		Forget: ForgetConfig{
+			Schedule:     c.ForgetSchedule,
+			ForgetPolicy: c.ForgetPolicy,
+		},
+		Prune: PruneConfig{
+			Schedule:      c.PruneSchedule,
+			MaxUnused:     c.PruneMaxUnused,
+			MaxRepackSize: c.PruneMaxRepackSize,
+		},
+		Check: CheckConfig{
+			Schedule:        c.CheckSchedule,
+			ReadDataSubsets: c.CheckSubsets,
+		},
+		RestoreDrill: RestoreDrillConfig{
+			Schedule:     c.DrillSchedule,
+			SampleSize:   c.DrillSampleSize,
+			Verification: c.DrillVerification,
+			ScratchDir:   c.DrillScratchDir,
+		},
+	}
+	if env[restic.EnvResticRepository] == "" {
+		job.Repository = c.ResticRepository
+	}
+	if env[restic.EnvResticPasswordFile] == "" {
+		job.PasswordFile = c.ResticPasswordFile
+	}
+	return job
+}
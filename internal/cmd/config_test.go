@@ -1,9 +1,13 @@
 package cmd_test
 
 import (
+	"log/slog"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/fhofherr/rsched/internal/cmd"
+	"github.com/fhofherr/rsched/internal/restic"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -20,8 +24,15 @@ func TestLoadConfig(t *testing.T) {
 			name: "Default config",
 			assertCfg: func(t *testing.T, actual cmd.Config) {
 				expected := cmd.Config{
-					BackupSchedule: "@hourly",
-					BackupPath:     "/",
+					LogFormat:       cmd.LogFormatText,
+					BackupSchedule:  "@hourly",
+					BackupPaths:     []string{"/"},
+					KillGracePeriod: restic.DefaultKillGracePeriod,
+					CatchUpWindow:   cmd.DefaultCatchUpWindow,
+					Retry: restic.RetryPolicy{
+						InitialBackoff: restic.DefaultInitialBackoff,
+						MaxBackoff:     restic.DefaultMaxBackoff,
+					},
 				}
 				assert.Equal(t, expected, actual)
 			},
@@ -37,9 +48,164 @@ func TestLoadConfig(t *testing.T) {
 			name: "Pass backup path",
 			args: []string{"-restic-backup-path", "/path/to/backup"},
 			assertCfg: func(t *testing.T, actual cmd.Config) {
-				assert.Equal(t, "/path/to/backup", actual.BackupPath)
+				assert.Equal(t, []string{"/path/to/backup"}, actual.BackupPaths)
 			},
 		},
+		{
+			name: "Pass multiple backup paths and excludes",
+			args: []string{
+				"-restic-backup-path", "/path/to/backup",
+				"-restic-backup-path", "/other/path",
+				"-backup-exclude", "*.tmp",
+				"-backup-exclude", "*.log",
+				"-backup-exclude-file", "/path/to/excludes",
+				"-backup-iexclude", "*.BAK",
+				"-backup-exclude-caches",
+				"-backup-exclude-if-present", ".nobackup",
+				"-backup-exclude-larger-than", "1G",
+				"-backup-one-file-system",
+			},
+			assertCfg: func(t *testing.T, actual cmd.Config) {
+				assert.Equal(t, []string{"/path/to/backup", "/other/path"}, actual.BackupPaths)
+				assert.Equal(t, []string{"*.tmp", "*.log"}, actual.BackupExcludes)
+				assert.Equal(t, []string{"/path/to/excludes"}, actual.BackupExcludeFiles)
+				assert.Equal(t, []string{"*.BAK"}, actual.BackupIExcludes)
+				assert.True(t, actual.BackupExcludeCaches)
+				assert.Equal(t, []string{".nobackup"}, actual.BackupExcludeIfPresent)
+				assert.Equal(t, "1G", actual.BackupExcludeLargerThan)
+				assert.True(t, actual.BackupOneFileSystem)
+			},
+		},
+		{
+			name: "Pass log level and format",
+			args: []string{"-log-level", "debug", "-log-format", "json"},
+			assertCfg: func(t *testing.T, actual cmd.Config) {
+				assert.Equal(t, slog.LevelDebug, actual.LogLevel)
+				assert.Equal(t, cmd.LogFormatJSON, actual.LogFormat)
+			},
+		},
+		{
+			name:      "Invalid log format",
+			args:      []string{"-log-format", "xml"},
+			assertCfg: func(t *testing.T, actual cmd.Config) {},
+			assertErr: assert.Error,
+		},
+		{
+			name: "Pass HTTP address and max backup age",
+			args: []string{"-http-address", ":8080", "-health-max-backup-age", "25h"},
+			assertCfg: func(t *testing.T, actual cmd.Config) {
+				assert.Equal(t, ":8080", actual.HTTPAddress)
+				assert.Equal(t, 25*time.Hour, actual.HealthMaxBackupAge)
+			},
+		},
+		{
+			name: "Pass shutdown timeout",
+			args: []string{"-shutdown-timeout", "1m"},
+			assertCfg: func(t *testing.T, actual cmd.Config) {
+				assert.Equal(t, time.Minute, actual.ShutdownTimeout)
+			},
+		},
+		{
+			name: "Pass state file and catch up window",
+			args: []string{"-state-file", "/var/lib/rsched/state.json", "-catch-up-window", "48h"},
+			assertCfg: func(t *testing.T, actual cmd.Config) {
+				assert.Equal(t, "/var/lib/rsched/state.json", actual.StateFile)
+				assert.Equal(t, 48*time.Hour, actual.CatchUpWindow)
+			},
+		},
+		{
+			name: "Pass job timeout and kill grace period",
+			args: []string{"-job-timeout", "6h", "-kill-grace-period", "1m"},
+			assertCfg: func(t *testing.T, actual cmd.Config) {
+				assert.Equal(t, 6*time.Hour, actual.JobTimeout)
+				assert.Equal(t, time.Minute, actual.KillGracePeriod)
+			},
+		},
+		{
+			name: "Pass overlap policy",
+			args: []string{"-overlap-policy", "skip"},
+			assertCfg: func(t *testing.T, actual cmd.Config) {
+				assert.Equal(t, restic.OverlapSkip, actual.OverlapPolicy)
+			},
+		},
+		{
+			name:      "Invalid overlap policy",
+			args:      []string{"-overlap-policy", "invalid"},
+			assertCfg: func(t *testing.T, actual cmd.Config) {},
+			assertErr: assert.Error,
+		},
+		{
+			name: "Pass time zone",
+			args: []string{"-time-zone", "Europe/Berlin"},
+			assertCfg: func(t *testing.T, actual cmd.Config) {
+				assert.Equal(t, "Europe/Berlin", actual.TimeZone)
+			},
+		},
+		{
+			name:      "Invalid time zone",
+			args:      []string{"-time-zone", "Mars/Olympus_Mons"},
+			assertCfg: func(t *testing.T, actual cmd.Config) {},
+			assertErr: assert.Error,
+		},
+		{
+			name: "Pass start delay",
+			args: []string{"-start-delay", "10m", "-start-delay-deterministic"},
+			assertCfg: func(t *testing.T, actual cmd.Config) {
+				expected := restic.StartDelay{Max: 10 * time.Minute, Deterministic: true}
+				assert.Equal(t, expected, actual.StartDelay)
+			},
+		},
+		{
+			name: "Pass windows",
+			args: []string{
+				"-allowed-window", "mon-fri 22:00-06:00",
+				"-allowed-window", "sat,sun",
+				"-blocked-window", "2023-12-24T00:00:00Z/2023-12-27T00:00:00Z",
+				"-defer-blocked-runs",
+			},
+			assertCfg: func(t *testing.T, actual cmd.Config) {
+				assert.Len(t, actual.Windows.Allowed, 2)
+				assert.Len(t, actual.Windows.Blocked, 1)
+				assert.True(t, actual.Windows.Defer)
+			},
+		},
+		{
+			name:      "Invalid window",
+			args:      []string{"-blocked-window", "someday"},
+			assertCfg: func(t *testing.T, actual cmd.Config) {},
+			assertErr: assert.Error,
+		},
+		{
+			name: "Pass retry policy",
+			args: []string{
+				"-retry-max-attempts", "3",
+				"-retry-initial-backoff", "1m",
+				"-retry-max-backoff", "1h",
+				"-retry-jitter", "0.2",
+			},
+			assertCfg: func(t *testing.T, actual cmd.Config) {
+				expected := restic.RetryPolicy{
+					MaxAttempts:    3,
+					InitialBackoff: time.Minute,
+					MaxBackoff:     time.Hour,
+					Jitter:         0.2,
+				}
+				assert.Equal(t, expected, actual.Retry)
+			},
+		},
+		{
+			name: "Pass backup init policy",
+			args: []string{"-backup-init-policy", "always-check"},
+			assertCfg: func(t *testing.T, actual cmd.Config) {
+				assert.Equal(t, restic.InitAlwaysCheck, actual.BackupInitPolicy)
+			},
+		},
+		{
+			name:      "Invalid backup init policy",
+			args:      []string{"-backup-init-policy", "sometimes"},
+			assertCfg: func(t *testing.T, actual cmd.Config) {},
+			assertErr: assert.Error,
+		},
 		{
 			name: "Pass password file",
 			args: []string{"-restic-password-file", "/path/to/password/file"},
@@ -61,6 +227,258 @@ func TestLoadConfig(t *testing.T) {
 				assert.Equal(t, "/path/to/restic", actual.ResticBinary)
 			},
 		},
+		{
+			name: "Pass forget schedule and policy",
+			args: []string{
+				"-forget-schedule", "@daily",
+				"-forget-keep-last", "1",
+				"-forget-keep-hourly", "2",
+				"-forget-keep-daily", "3",
+				"-forget-keep-weekly", "4",
+				"-forget-keep-monthly", "5",
+				"-forget-keep-yearly", "6",
+				"-forget-keep-within", "1y",
+				"-forget-keep-tag", "important",
+				"-forget-keep-tag", "keep",
+			},
+			assertCfg: func(t *testing.T, actual cmd.Config) {
+				assert.Equal(t, "@daily", actual.ForgetSchedule)
+				assert.Equal(t, restic.ForgetPolicy{
+					KeepLast:    1,
+					KeepHourly:  2,
+					KeepDaily:   3,
+					KeepWeekly:  4,
+					KeepMonthly: 5,
+					KeepYearly:  6,
+					KeepWithin:  "1y",
+					KeepTags:    []string{"important", "keep"},
+				}, actual.ForgetPolicy)
+			},
+		},
+		{
+			name: "Pass prune schedule and options",
+			args: []string{
+				"-prune-schedule", "@weekly",
+				"-prune-max-unused", "10%",
+				"-prune-max-repack-size", "2G",
+			},
+			assertCfg: func(t *testing.T, actual cmd.Config) {
+				assert.Equal(t, "@weekly", actual.PruneSchedule)
+				assert.Equal(t, "10%", actual.PruneMaxUnused)
+				assert.Equal(t, "2G", actual.PruneMaxRepackSize)
+			},
+		},
+		{
+			name: "Pass check schedule and subsets",
+			args: []string{"-check-schedule", "@daily", "-check-read-data-subsets", "7"},
+			assertCfg: func(t *testing.T, actual cmd.Config) {
+				assert.Equal(t, "@daily", actual.CheckSchedule)
+				assert.Equal(t, 7, actual.CheckSubsets)
+			},
+		},
+		{
+			name: "Pass restore drill options",
+			args: []string{
+				"-restore-drill-schedule", "@weekly",
+				"-restore-drill-sample-size", "100",
+				"-restore-drill-verification", "live",
+				"-restore-drill-scratch-dir", "/path/to/scratch",
+			},
+			assertCfg: func(t *testing.T, actual cmd.Config) {
+				assert.Equal(t, "@weekly", actual.DrillSchedule)
+				assert.Equal(t, 100, actual.DrillSampleSize)
+				assert.Equal(t, restic.DrillVerifyLive, actual.DrillVerification)
+				assert.Equal(t, "/path/to/scratch", actual.DrillScratchDir)
+			},
+		},
+		{
+			name:      "Invalid restore drill verification",
+			args:      []string{"-restore-drill-verification", "invalid"},
+			assertCfg: func(t *testing.T, actual cmd.Config) {},
+			assertErr: assert.Error,
+		},
+		{
+			name: "Load jobs from config file",
+			args: []string{"-config", filepath.Join("testdata", "jobs.yaml")},
+			assertCfg: func(t *testing.T, actual cmd.Config) {
+				expected := []cmd.JobConfig{
+					{
+						Name:         "home",
+						Repository:   "/srv/restic/home",
+						PasswordFile: "/etc/rsched/home.password",
+						Retry: restic.RetryPolicy{
+							MaxAttempts:    5,
+							InitialBackoff: time.Minute,
+							MaxBackoff:     30 * time.Minute,
+							Jitter:         0.2,
+						},
+						Timeout:         6 * time.Hour,
+						KillGracePeriod: 2 * time.Minute,
+						Overlap:         restic.OverlapSkip,
+						TimeZone:        "Europe/Berlin",
+						StartDelay:      restic.StartDelay{Max: 15 * time.Minute, Deterministic: true},
+						Windows: restic.Windows{
+							Allowed: restic.WindowList{{Start: 22 * time.Hour, End: 6 * time.Hour}},
+							Blocked: restic.WindowList{
+								{Days: []time.Weekday{time.Saturday, time.Sunday}},
+								{
+									From:  time.Date(2023, 12, 24, 0, 0, 0, 0, time.UTC),
+									Until: time.Date(2023, 12, 27, 0, 0, 0, 0, time.UTC),
+								},
+							},
+							Defer: true,
+						},
+						Backup: cmd.BackupConfig{
+							Schedule:      "@hourly",
+							Paths:         []string{"/home"},
+							Excludes:      []string{"*.tmp"},
+							ExcludeCaches: true,
+						},
+						Forget: cmd.ForgetConfig{
+							Schedule: "@daily",
+							ForgetPolicy: restic.ForgetPolicy{
+								KeepDaily:  7,
+								KeepWeekly: 4,
+								KeepTags:   []string{"important"},
+							},
+						},
+						Prune: cmd.PruneConfig{
+							Schedule:  "@weekly",
+							MaxUnused: "10%",
+						},
+						Check: cmd.CheckConfig{
+							Schedule:        "@weekly",
+							ReadDataSubsets: 4,
+						},
+						RestoreDrill: cmd.RestoreDrillConfig{
+							Schedule:     "@monthly",
+							SampleSize:   100,
+							Verification: restic.DrillVerifyLive,
+						},
+					},
+					{
+						Name:            "database",
+						RepositoryFile:  "/etc/rsched/database.repository",
+						PasswordCommand: "pass show restic/database",
+						Env:             map[string]string{"AWS_ACCESS_KEY_ID": "some-key-id"},
+						Backup: cmd.BackupConfig{
+							Schedule: "0 3 * * *",
+							Paths:    []string{"/var/backups/postgres", "/var/backups/mysql"},
+							Hooks: restic.Hooks{
+								Before: []restic.Hook{
+									{
+										Command: "pg_dumpall > /var/backups/postgres/dump.sql",
+										Timeout: 30 * time.Minute,
+									},
+								},
+								Always: []restic.Hook{
+									{
+										Command:   "rm -f /var/backups/postgres/dump.sql",
+										OnFailure: restic.HookContinue,
+									},
+								},
+							},
+						},
+						Forget: cmd.ForgetConfig{
+							ForgetPolicy: restic.ForgetPolicy{KeepDaily: 14},
+						},
+						Pipeline: cmd.PipelineConfig{
+							Schedule: "0 4 * * *",
+							Steps: []cmd.PipelineStepConfig{
+								{Operation: cmd.OperationBackup},
+								{Operation: cmd.OperationForget},
+								{Operation: cmd.OperationCheck, When: restic.StepAlways},
+							},
+						},
+					},
+				}
+				assert.Equal(t, expected, actual.Jobs)
+			},
+		},
+		{
+			name:      "Config file does not exist",
+			args:      []string{"-config", filepath.Join("testdata", "missing.yaml")},
+			assertCfg: func(t *testing.T, actual cmd.Config) {},
+			assertErr: assert.Error,
+		},
+		{
+			name:      "Config file with invalid hook",
+			args:      []string{"-config", filepath.Join("testdata", "jobs_invalid_hook.yaml")},
+			assertCfg: func(t *testing.T, actual cmd.Config) {},
+			assertErr: assert.Error,
+		},
+		{
+			name:      "Config file with invalid retry policy",
+			args:      []string{"-config", filepath.Join("testdata", "jobs_invalid_retry.yaml")},
+			assertCfg: func(t *testing.T, actual cmd.Config) {},
+			assertErr: assert.Error,
+		},
+		{
+			name:      "Config file with invalid time zone",
+			args:      []string{"-config", filepath.Join("testdata", "jobs_invalid_time_zone.yaml")},
+			assertCfg: func(t *testing.T, actual cmd.Config) {},
+			assertErr: assert.Error,
+		},
+		{
+			name:      "Config file with invalid schedule",
+			args:      []string{"-config", filepath.Join("testdata", "jobs_invalid_schedule.yaml")},
+			assertCfg: func(t *testing.T, actual cmd.Config) {},
+			assertErr: assert.Error,
+		},
+		{
+			name:      "Config file with invalid start delay",
+			args:      []string{"-config", filepath.Join("testdata", "jobs_invalid_start_delay.yaml")},
+			assertCfg: func(t *testing.T, actual cmd.Config) {},
+			assertErr: assert.Error,
+		},
+		{
+			name:      "Config file with invalid window",
+			args:      []string{"-config", filepath.Join("testdata", "jobs_invalid_window.yaml")},
+			assertCfg: func(t *testing.T, actual cmd.Config) {},
+			assertErr: assert.Error,
+		},
+		{
+			name:      "Config file with invalid pipeline",
+			args:      []string{"-config", filepath.Join("testdata", "jobs_invalid_pipeline.yaml")},
+			assertCfg: func(t *testing.T, actual cmd.Config) {},
+			assertErr: assert.Error,
+		},
+		{
+			name:      "Config file with backup schedule but no paths",
+			args:      []string{"-config", filepath.Join("testdata", "jobs_invalid_backup.yaml")},
+			assertCfg: func(t *testing.T, actual cmd.Config) {},
+			assertErr: assert.Error,
+		},
+		{
+			name:      "Config file with pipeline backup step but no paths",
+			args:      []string{"-config", filepath.Join("testdata", "jobs_invalid_pipeline_backup.yaml")},
+			assertCfg: func(t *testing.T, actual cmd.Config) {},
+			assertErr: assert.Error,
+		},
+		{
+			name:      "Config file with duplicate job names",
+			args:      []string{"-config", filepath.Join("testdata", "jobs_duplicate_name.yaml")},
+			assertCfg: func(t *testing.T, actual cmd.Config) {},
+			assertErr: assert.Error,
+		},
+		{
+			name:      "Config file with unknown field",
+			args:      []string{"-config", filepath.Join("testdata", "jobs_unknown_field.yaml")},
+			assertCfg: func(t *testing.T, actual cmd.Config) {},
+			assertErr: assert.Error,
+		},
+		{
+			name:      "Config file with missing job name",
+			args:      []string{"-config", filepath.Join("testdata", "jobs_missing_name.yaml")},
+			assertCfg: func(t *testing.T, actual cmd.Config) {},
+			assertErr: assert.Error,
+		},
+		{
+			name:      "Config file with forget schedule but no policy",
+			args:      []string{"-config", filepath.Join("testdata", "jobs_invalid_forget.yaml")},
+			assertCfg: func(t *testing.T, actual cmd.Config) {},
+			assertErr: assert.Error,
+		},
 	}
 
 	for _, tt := range tests {
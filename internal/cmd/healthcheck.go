@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/peterbourgon/ff/v3"
+)
+
+// Healthcheck implements the rsched healthcheck sub command.
+//
+// Healthcheck queries the /healthz endpoint of a running rsched instance and
+// returns the exit code the sub command should exit with. The address of the
+// rsched instance is read from the -http-address flag or the
+// RSCHED_HTTP_ADDRESS environment variable. This allows to use the sub
+// command as health check of the rsched container.
+func Healthcheck(args []string) int {
+	var (
+		addr    string
+		timeout time.Duration
+	)
+
+	fs := flag.NewFlagSet("rsched healthcheck", flag.ContinueOnError)
+	fs.StringVar(&addr, "http-address", "", "Address the rsched instance listens on for HTTP requests.")
+	fs.DurationVar(&timeout, "timeout", 5*time.Second, "Timeout of the health check.")
+	if err := ff.Parse(fs, args, ff.WithEnvVarPrefix("RSCHED")); err != nil {
+		fmt.Printf("\nparse config: %v\n", err)
+		return ExitConfigError
+	}
+	if addr == "" {
+		fmt.Println("healthcheck: http address not set")
+		return ExitConfigError
+	}
+
+	url, err := healthURL(addr)
+	if err != nil {
+		fmt.Printf("healthcheck: %v\n", err)
+		return ExitConfigError
+	}
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		fmt.Printf("healthcheck: %v\n", err)
+		return ExitConfigError
+	}
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		fmt.Printf("healthcheck: %v\n", err)
+		return ExitFailure
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	fmt.Printf("healthcheck: %s: %s\n", resp.Status, strings.TrimSpace(string(body)))
+	if resp.StatusCode != http.StatusOK {
+		return ExitFailure
+	}
+	return ExitSuccess
+}
+
+// healthURL returns the URL of the /healthz endpoint of an rsched instance
+// listening on addr. Unspecified hosts are replaced with localhost.
+func healthURL(addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("invalid http address: %v", err)
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "localhost"
+	}
+	return fmt.Sprintf("http://%s/healthz", net.JoinHostPort(host, port)), nil
+}
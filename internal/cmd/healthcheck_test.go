@@ -0,0 +1,48 @@
+package cmd_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fhofherr/rsched/internal/cmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthcheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		expected int
+	}{
+		{name: "healthy", status: http.StatusOK, expected: cmd.ExitSuccess},
+		{name: "unhealthy", status: http.StatusServiceUnavailable, expected: cmd.ExitFailure},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/healthz", r.URL.Path)
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			code := cmd.Healthcheck([]string{"-http-address", srv.Listener.Addr().String()})
+			assert.Equal(t, tt.expected, code)
+		})
+	}
+
+	t.Run("rsched not reachable", func(t *testing.T) {
+		srv := httptest.NewServer(http.NotFoundHandler())
+		addr := srv.Listener.Addr().String()
+		srv.Close()
+
+		assert.Equal(t, cmd.ExitFailure, cmd.Healthcheck([]string{"-http-address", addr}))
+	})
+
+	t.Run("http address missing", func(t *testing.T) {
+		t.Setenv("RSCHED_HTTP_ADDRESS", "")
+		assert.Equal(t, cmd.ExitConfigError, cmd.Healthcheck(nil))
+	})
+}
@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Handler returns the http.Handler serving rsched's HTTP endpoints.
+//
+// Prometheus metrics are exposed at /metrics. /readyz reports if the
+// scheduler is running. /healthz additionally reports rsched as unhealthy
+// if the last backup of any job is older than cfg.HealthMaxBackupAge. Jobs
+// without any backup are reported as unhealthy once cfg.HealthMaxBackupAge
+// passed since Handler was called. Both health endpoints respond with status
+// 503 if rsched is unhealthy.
+func (r *RSched) Handler(cfg Config) http.Handler {
+	started := time.Now()
+	gatherer := r.Gatherer
+	if gatherer == nil {
+		gatherer = prometheus.DefaultGatherer
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}))
+	mux.Handle("/healthz", healthHandler(func() error {
+		if err := r.checkRunning(); err != nil {
+			return err
+		}
+		return r.checkBackupAge(cfg.HealthMaxBackupAge, started)
+	}))
+	mux.Handle("/readyz", healthHandler(r.checkRunning))
+	return mux
+}
+
+func (r *RSched) checkRunning() error {
+	if !r.Scheduler.Running() {
+		return errors.New("scheduler not running")
+	}
+	return nil
+}
+
+func (r *RSched) checkBackupAge(maxAge time.Duration, started time.Time) error {
+	if maxAge <= 0 {
+		return nil
+	}
+	for name, last := range r.Scheduler.LastBackups() {
+		if last.IsZero() {
+			if time.Since(started) > maxAge {
+				return fmt.Errorf("no backup of job %q within %s", name, maxAge)
+			}
+			continue
+		}
+		if age := time.Since(last); age > maxAge {
+			return fmt.Errorf("last backup of job %q is %s old", name, age.Round(time.Second))
+		}
+	}
+	return nil
+}
+
+// healthHandler returns an http.Handler responding with status 200 if check
+// returns no error and with status 503 otherwise.
+func healthHandler(check func() error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if err := check(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+}
+
+// serveHTTP starts listening for HTTP requests on cfg.HTTPAddress in a
+// separate go routine.
+func (r *RSched) serveHTTP(cfg Config) {
+	addr := cfg.HTTPAddress
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           r.Handler(cfg),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	r.mu.Lock()
+	r.server = srv
+	r.mu.Unlock()
+
+	go func() {
+		slog.Info("Listening for HTTP requests", "address", addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("HTTP listener failed", "error", err)
+		}
+	}()
+}
+
+// shutdownHTTP stops the HTTP listener if it was started.
+func (r *RSched) shutdownHTTP() {
+	r.mu.Lock()
+	srv := r.server
+	r.mu.Unlock()
+
+	if srv == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Error("Failed to shut down HTTP listener", "error", err)
+	}
+}
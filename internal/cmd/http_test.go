@@ -0,0 +1,132 @@
+package cmd_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fhofherr/rsched/internal/cmd"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRSched_Handler(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		cfg      cmd.Config
+		mock     func(s *cmd.MockResticScheduler)
+		expected int
+		body     string
+	}{
+		{
+			name:     "metrics",
+			path:     "/metrics",
+			mock:     func(s *cmd.MockResticScheduler) {},
+			expected: http.StatusOK,
+			body:     "test_gauge 0",
+		},
+		{
+			name: "ready",
+			path: "/readyz",
+			mock: func(s *cmd.MockResticScheduler) {
+				s.On("Running").Return(true)
+			},
+			expected: http.StatusOK,
+		},
+		{
+			name: "not ready",
+			path: "/readyz",
+			mock: func(s *cmd.MockResticScheduler) {
+				s.On("Running").Return(false)
+			},
+			expected: http.StatusServiceUnavailable,
+			body:     "scheduler not running",
+		},
+		{
+			name: "healthy",
+			path: "/healthz",
+			cfg:  cmd.Config{HealthMaxBackupAge: time.Hour},
+			mock: func(s *cmd.MockResticScheduler) {
+				s.On("Running").Return(true)
+				s.On("LastBackups").Return(map[string]time.Time{
+					"default": time.Now().Add(-30 * time.Minute),
+				})
+			},
+			expected: http.StatusOK,
+		},
+		{
+			name: "healthy without max backup age",
+			path: "/healthz",
+			mock: func(s *cmd.MockResticScheduler) {
+				s.On("Running").Return(true)
+			},
+			expected: http.StatusOK,
+		},
+		{
+			name: "scheduler not running",
+			path: "/healthz",
+			cfg:  cmd.Config{HealthMaxBackupAge: time.Hour},
+			mock: func(s *cmd.MockResticScheduler) {
+				s.On("Running").Return(false)
+			},
+			expected: http.StatusServiceUnavailable,
+			body:     "scheduler not running",
+		},
+		{
+			name: "no backup within grace period",
+			path: "/healthz",
+			cfg:  cmd.Config{HealthMaxBackupAge: time.Hour},
+			mock: func(s *cmd.MockResticScheduler) {
+				s.On("Running").Return(true)
+				s.On("LastBackups").Return(map[string]time.Time{"default": {}})
+			},
+			expected: http.StatusOK,
+		},
+		{
+			name: "no backup after grace period",
+			path: "/healthz",
+			cfg:  cmd.Config{HealthMaxBackupAge: time.Nanosecond},
+			mock: func(s *cmd.MockResticScheduler) {
+				s.On("Running").Return(true)
+				s.On("LastBackups").Return(map[string]time.Time{"default": {}})
+			},
+			expected: http.StatusServiceUnavailable,
+			body:     `no backup of job "default" within 1ns`,
+		},
+		{
+			name: "backup too old",
+			path: "/healthz",
+			cfg:  cmd.Config{HealthMaxBackupAge: time.Hour},
+			mock: func(s *cmd.MockResticScheduler) {
+				s.On("Running").Return(true)
+				s.On("LastBackups").Return(map[string]time.Time{
+					"default": time.Now().Add(-2 * time.Hour),
+				})
+			},
+			expected: http.StatusServiceUnavailable,
+			body:     `last backup of job "default" is 2h0m0s old`,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			reg.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_gauge"}))
+			s := &cmd.MockResticScheduler{}
+			tt.mock(s)
+			r := &cmd.RSched{
+				Scheduler: s,
+				Gatherer:  reg,
+			}
+
+			rec := httptest.NewRecorder()
+			r.Handler(tt.cfg).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			assert.Equal(t, tt.expected, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.body)
+			s.AssertExpectations(t)
+		})
+	}
+}
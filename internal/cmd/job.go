@@ -0,0 +1,299 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/fhofherr/rsched/internal/restic"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultJobName is the name of the job created from the command line flags
+// if no config file is used.
+const DefaultJobName = "default"
+
+// JobConfig contains the configuration of a single named job.
+//
+// Each job targets a single restic repository. The individual restic
+// operations of a job are scheduled independently. An operation is disabled
+// if its schedule is empty. Additionally the operations may be run one after
+// the other as the steps of the pipeline of the job. Pipeline steps use the
+// configuration of the respective operation regardless of its schedule.
+type JobConfig struct {
+	Name string `yaml:"name"`
+
+	// Location of the restic repository and the password source. Values set
+	// here take precedence over the respective restic environment variables.
+	Repository      string `yaml:"repository"`
+	RepositoryFile  string `yaml:"repository_file"`
+	PasswordFile    string `yaml:"password_file"`
+	PasswordCommand string `yaml:"password_command"`
+
+	// Env contains additional environment variables passed to restic, e.g.
+	// credentials for the storage backend.
+	Env map[string]string `yaml:"env"`
+
+	// Retry defines how failed runs of any operation of the job are
+	// retried.
+	Retry restic.RetryPolicy `yaml:"retry"`
+
+	// Timeout is the maximum duration of a single attempt of any operation
+	// of the job. Disabled if zero.
+	Timeout time.Duration `yaml:"timeout"`
+
+	// KillGracePeriod is the time restic gets to exit after it was
+	// interrupted before it is killed. Defaults to
+	// restic.DefaultKillGracePeriod.
+	KillGracePeriod time.Duration `yaml:"kill_grace_period"`
+
+	// Overlap defines what happens if an operation of the job becomes due
+	// while its previous run is still in progress.
+	Overlap restic.OverlapPolicy `yaml:"overlap"`
+
+	// TimeZone is the name of the time zone the schedules of the job are
+	// evaluated in, e.g. Europe/Berlin. Defaults to the local time zone.
+	TimeZone string `yaml:"time_zone"`
+
+	// StartDelay delays the start of each run of any operation of the job.
+	StartDelay restic.StartDelay `yaml:"start_delay"`
+
+	// Windows restricts when the operations of the job may run.
+	Windows restic.Windows `yaml:"windows"`
+
+	Backup       BackupConfig       `yaml:"backup"`
+	Forget       ForgetConfig       `yaml:"forget"`
+	Prune        PruneConfig        `yaml:"prune"`
+	Check        CheckConfig        `yaml:"check"`
+	RestoreDrill RestoreDrillConfig `yaml:"restore_drill"`
+	Pipeline     PipelineConfig     `yaml:"pipeline"`
+}
+
+// BackupConfig contains the configuration of the backups created by a job.
+type BackupConfig struct {
+	Schedule          string   `yaml:"schedule"`
+	Paths             []string `yaml:"paths"`
+	Excludes          []string `yaml:"exclude"`
+	ExcludeFiles      []string `yaml:"exclude_file"`
+	IExcludes         []string `yaml:"iexclude"`
+	ExcludeCaches     bool     `yaml:"exclude_caches"`
+	ExcludeIfPresent  []string `yaml:"exclude_if_present"`
+	ExcludeLargerThan string   `yaml:"exclude_larger_than"`
+	OneFileSystem     bool     `yaml:"one_file_system"`
+
+	InitPolicy restic.InitPolicy `yaml:"init_policy"`
+	Hooks      restic.Hooks      `yaml:"hooks"`
+}
+
+// ForgetConfig contains the configuration of the snapshot removal of a job.
+type ForgetConfig struct {
+	Schedule            string `yaml:"schedule"`
+	restic.ForgetPolicy `yaml:",inline"`
+}
+
+// PruneConfig contains the configuration of the pruning of a job.
+type PruneConfig struct {
+	Schedule      string `yaml:"schedule"`
+	MaxUnused     string `yaml:"max_unused"`
+	MaxRepackSize string `yaml:"max_repack_size"`
+}
+
+// CheckConfig contains the configuration of the integrity checks of a job.
+type CheckConfig struct {
+	Schedule        string `yaml:"schedule"`
+	ReadDataSubsets int    `yaml:"read_data_subsets"`
+}
+
+// RestoreDrillConfig contains the configuration of the restore drills of a
+// job.
+type RestoreDrillConfig struct {
+	Schedule     string                   `yaml:"schedule"`
+	SampleSize   int                      `yaml:"sample_size"`
+	Verification restic.DrillVerification `yaml:"verification"`
+	ScratchDir   string                   `yaml:"scratch_dir"`
+}
+
+// Operations which may be used as pipeline steps.
+const (
+	OperationBackup       = "backup"
+	OperationForget       = "forget"
+	OperationPrune        = "prune"
+	OperationCheck        = "check"
+	OperationRestoreDrill = "restore_drill"
+)
+
+// PipelineConfig contains the configuration of the pipeline of a job.
+type PipelineConfig struct {
+	Schedule string               `yaml:"schedule"`
+	Steps    []PipelineStepConfig `yaml:"steps"`
+}
+
+// PipelineStepConfig contains the configuration of a single step of a
+// pipeline.
+type PipelineStepConfig struct {
+	// Operation is one of the operations of the job, e.g. backup or
+	// restore_drill.
+	Operation string `yaml:"operation"`
+
+	// When decides whether the step runs depending on the outcome of the
+	// previous steps. Defaults to restic.StepOnSuccess.
+	When restic.StepCondition `yaml:"when"`
+}
+
+// Validate checks if c contains all required values.
+func (c JobConfig) Validate() error {
+	if c.Name == "" {
+		return errors.New("job name missing")
+	}
+	if c.Repository != "" && c.RepositoryFile != "" {
+		return fmt.Errorf("job %q: repository and repository_file are mutually exclusive", c.Name)
+	}
+	if c.PasswordFile != "" && c.PasswordCommand != "" {
+		return fmt.Errorf("job %q: password_file and password_command are mutually exclusive", c.Name)
+	}
+	if c.Timeout < 0 {
+		return fmt.Errorf("job %q: negative timeout", c.Name)
+	}
+	if c.KillGracePeriod < 0 {
+		return fmt.Errorf("job %q: negative kill grace period", c.Name)
+	}
+	if c.TimeZone != "" {
+		if _, err := time.LoadLocation(c.TimeZone); err != nil {
+			return fmt.Errorf("job %q: time zone: %v", c.Name, err)
+		}
+	}
+	for _, s := range []struct{ kind, schedule string }{
+		{"backup", c.Backup.Schedule},
+		{"forget", c.Forget.Schedule},
+		{"prune", c.Prune.Schedule},
+		{"check", c.Check.Schedule},
+		{"restore drill", c.RestoreDrill.Schedule},
+		{"pipeline", c.Pipeline.Schedule},
+	} {
+		if s.schedule == "" {
+			continue
+		}
+		if err := restic.ValidateSchedule(s.schedule); err != nil {
+			return fmt.Errorf("job %q: %s schedule: %v", c.Name, s.kind, err)
+		}
+	}
+	if err := c.Retry.Validate(); err != nil {
+		return fmt.Errorf("job %q: %v", c.Name, err)
+	}
+	if err := c.StartDelay.Validate(); err != nil {
+		return fmt.Errorf("job %q: %v", c.Name, err)
+	}
+	if err := c.Windows.Validate(); err != nil {
+		return fmt.Errorf("job %q: %v", c.Name, err)
+	}
+	if err := c.Backup.Hooks.Validate(); err != nil {
+		return fmt.Errorf("job %q: %v", c.Name, err)
+	}
+	if c.Backup.Schedule != "" && len(c.Backup.Paths) == 0 {
+		return fmt.Errorf("job %q: backup schedule set but no paths configured", c.Name)
+	}
+	if c.Forget.Schedule != "" && c.Forget.IsZero() {
+		return fmt.Errorf("job %q: forget schedule set but no forget policy configured", c.Name)
+	}
+	if err := c.validatePipeline(); err != nil {
+		return fmt.Errorf("job %q: %v", c.Name, err)
+	}
+	return nil
+}
+
+func (c JobConfig) validatePipeline() error {
+	if c.Pipeline.Schedule == "" {
+		return nil
+	}
+	if len(c.Pipeline.Steps) == 0 {
+		return errors.New("pipeline schedule set but no steps configured")
+	}
+	for i, step := range c.Pipeline.Steps {
+		switch step.Operation {
+		case OperationBackup:
+			if len(c.Backup.Paths) == 0 {
+				return fmt.Errorf("pipeline step %d: no backup paths configured", i+1)
+			}
+		case OperationForget:
+			if c.Forget.IsZero() {
+				return fmt.Errorf("pipeline step %d: no forget policy configured", i+1)
+			}
+		case OperationPrune, OperationCheck, OperationRestoreDrill:
+		default:
+			return fmt.Errorf("pipeline step %d: unknown operation: %q", i+1, step.Operation)
+		}
+	}
+	return nil
+}
+
+// env returns the environment restic is called with for this job.
+//
+// The values configured for the job replace the respective variables in
+// base. Any alternatives to those variables are removed from the returned
+// environment. base itself is not modified.
+func (c JobConfig) env(base map[string]string) map[string]string {
+	env := make(map[string]string, len(base)+len(c.Env)+2)
+	for k, v := range base {
+		env[k] = v
+	}
+
+	replace := func(key, value string, alternatives ...string) {
+		if value == "" {
+			return
+		}
+		for _, alt := range alternatives {
+			delete(env, alt)
+		}
+		env[key] = value
+	}
+	replace(restic.EnvResticRepository, c.Repository, restic.EnvResticRepositoryFile)
+	replace(restic.EnvResticRepositoryFile, c.RepositoryFile, restic.EnvResticRepository)
+	replace(
+		restic.EnvResticPasswordFile, c.PasswordFile,
+		restic.EnvResticPassword, restic.EnvResticPasswordCommand,
+	)
+	replace(
+		restic.EnvResticPasswordCommand, c.PasswordCommand,
+		restic.EnvResticPassword, restic.EnvResticPasswordFile,
+	)
+
+	for k, v := range c.Env {
+		env[k] = v
+	}
+	return env
+}
+
+// loadJobs reads the job definitions from the config file at path.
+func loadJobs(path string) ([]JobConfig, error) {
+	var file struct {
+		Jobs []JobConfig `yaml:"jobs"`
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("load jobs: %v", err)
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(&file); err != nil {
+		return nil, fmt.Errorf("load jobs: %s: %v", path, err)
+	}
+	if len(file.Jobs) == 0 {
+		return nil, fmt.Errorf("load jobs: %s: no jobs defined", path)
+	}
+
+	names := make(map[string]bool, len(file.Jobs))
+	for _, job := range file.Jobs {
+		if err := job.Validate(); err != nil {
+			return nil, fmt.Errorf("load jobs: %s: %v", path, err)
+		}
+		if names[job.Name] {
+			return nil, fmt.Errorf("load jobs: %s: duplicate job name: %q", path, job.Name)
+		}
+		names[job.Name] = true
+	}
+	return file.Jobs, nil
+}
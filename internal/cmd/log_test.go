@@ -0,0 +1,39 @@
+package cmd_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/fhofherr/rsched/internal/cmd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewLogger(t *testing.T) {
+	t.Run("json", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		log := cmd.NewLogger(cmd.Config{LogLevel: slog.LevelWarn, LogFormat: cmd.LogFormatJSON}, &buf)
+		log.Info("not logged")
+		log.Warn("logged", "job", "default")
+
+		var entry map[string]interface{}
+		if !assert.NoError(t, json.Unmarshal(buf.Bytes(), &entry)) {
+			return
+		}
+		assert.Equal(t, "logged", entry["msg"])
+		assert.Equal(t, "WARN", entry["level"])
+		assert.Equal(t, "default", entry["job"])
+	})
+
+	t.Run("text", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		log := cmd.NewLogger(cmd.Config{LogFormat: cmd.LogFormatText}, &buf)
+		log.Debug("not logged")
+		log.Info("logged", "job", "default")
+		assert.Contains(t, buf.String(), "level=INFO msg=logged job=default")
+		assert.NotContains(t, buf.String(), "not logged")
+	})
+}
@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"time"
+
 	"github.com/fhofherr/rsched/internal/restic"
 	"github.com/stretchr/testify/mock"
 )
@@ -17,18 +19,86 @@ type MockResticScheduler struct {
 // Since restic.Option is a function which cannot be compared
 // restic.MatchOptions needs to be used together with mock.MatchedBy during
 // mocking.
-func (m *MockResticScheduler) ScheduleBackup(schedule, path string, os ...restic.Option) error {
+func (m *MockResticScheduler) ScheduleBackup(schedule string, paths []string, os ...restic.Option) error {
 	// Do not expand os to make this work with restic.MatchOptions
-	args := m.Called(schedule, path, os)
+	args := m.Called(schedule, paths, os)
 	return args.Error(0)
 }
 
-// Run registers a call to itself.
-func (m *MockResticScheduler) Run() {
-	m.Called()
+// ScheduleForget registers a call to itself and returns the arguments it was
+// mocked for.
+//
+// See ScheduleBackup for details on how to match the passed options.
+func (m *MockResticScheduler) ScheduleForget(schedule string, os ...restic.Option) error {
+	args := m.Called(schedule, os)
+	return args.Error(0)
+}
+
+// SchedulePrune registers a call to itself and returns the arguments it was
+// mocked for.
+//
+// See ScheduleBackup for details on how to match the passed options.
+func (m *MockResticScheduler) SchedulePrune(schedule string, os ...restic.Option) error {
+	args := m.Called(schedule, os)
+	return args.Error(0)
+}
+
+// ScheduleCheck registers a call to itself and returns the arguments it was
+// mocked for.
+//
+// See ScheduleBackup for details on how to match the passed options.
+func (m *MockResticScheduler) ScheduleCheck(schedule string, subsets int, os ...restic.Option) error {
+	args := m.Called(schedule, subsets, os)
+	return args.Error(0)
+}
+
+// ScheduleRestoreDrill registers a call to itself and returns the arguments
+// it was mocked for.
+//
+// See ScheduleBackup for details on how to match the passed options.
+func (m *MockResticScheduler) ScheduleRestoreDrill(schedule string, os ...restic.Option) error {
+	args := m.Called(schedule, os)
+	return args.Error(0)
+}
+
+// SchedulePipeline registers a call to itself and returns the arguments it
+// was mocked for.
+//
+// See ScheduleBackup for details on how to match the passed options. The
+// options of each step need to be matched the same way.
+func (m *MockResticScheduler) SchedulePipeline(
+	schedule string, steps []restic.PipelineStep, os ...restic.Option,
+) error {
+	args := m.Called(schedule, steps, os)
+	return args.Error(0)
+}
+
+// Run registers a call to itself and returns the error it was mocked for.
+func (m *MockResticScheduler) Run() error {
+	args := m.Called()
+	return args.Error(0)
 }
 
 // Shutdown registers a call to itself.
 func (m *MockResticScheduler) Shutdown() {
 	m.Called()
 }
+
+// Kill registers a call to itself.
+func (m *MockResticScheduler) Kill() {
+	m.Called()
+}
+
+// Running registers a call to itself and returns the value it was mocked
+// for.
+func (m *MockResticScheduler) Running() bool {
+	args := m.Called()
+	return args.Bool(0)
+}
+
+// LastBackups registers a call to itself and returns the value it was mocked
+// for.
+func (m *MockResticScheduler) LastBackups() map[string]time.Time {
+	args := m.Called()
+	return args.Get(0).(map[string]time.Time)
+}
@@ -1,58 +1,303 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
 
 	"github.com/fhofherr/rsched/internal/restic"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 // RSched implements the rsched command.
 type RSched struct {
 	Scheduler ResticScheduler
+
+	// Gatherer provides the metrics exposed by the HTTP listener. Defaults
+	// to prometheus.DefaultGatherer.
+	Gatherer prometheus.Gatherer
+
+	mu     sync.Mutex
+	server *http.Server
 }
 
-// Run executes rsched based on the passed config.
-func (r *RSched) Run(cfg Config) {
+// Exit codes returned by RSched.Run.
+const (
+	ExitSuccess          = 0
+	ExitFailure          = 1
+	ExitConfigError      = 2
+	ExitIncompleteBackup = 3
+)
+
+// Run executes rsched based on the passed config and returns the code the
+// rsched process should exit with.
+//
+// Run schedules all jobs defined in cfg.Jobs. If cfg.Jobs is empty a single
+// job is created from the remaining values of cfg. If any job cannot be
+// scheduled Run returns ExitConfigError without running any job.
+//
+// Run returns once the scheduler stops. This happens either after Shutdown
+// was called, or after all jobs were executed if all of them are scheduled
+// using restic.ScheduleOnce. In the latter case the exit code reflects the
+// result of the jobs: ExitIncompleteBackup if restic was not able to read
+// some files during a backup, ExitFailure if any job failed for any other
+// reason, and ExitSuccess otherwise.
+func (r *RSched) Run(cfg Config) int {
 	env := Environ()
 	if cfg.PrintVersion {
 		fmt.Printf("%s - %s\n", Version, GitHash)
-		return
+		return ExitSuccess
 	}
 
-	log.Printf("Rsched version %s", Version)
-	if cfg.ResticRepository != "" && env[restic.EnvResticRepository] == "" {
-		env[restic.EnvResticRepository] = cfg.ResticRepository
+	slog.Info("Starting rsched", "version", Version)
+	jobs := cfg.Jobs
+	if len(jobs) == 0 {
+		jobs = []JobConfig{cfg.implicitJob(env)}
 	}
-	if cfg.ResticPasswordFile != "" && env[restic.EnvResticPasswordFile] == "" {
-		env[restic.EnvResticPasswordFile] = cfg.ResticPasswordFile
+	for _, job := range jobs {
+		if err := r.scheduleJob(cfg, job, env); err != nil {
+			slog.Error("Failed to schedule job", "job", job.Name, "error", err)
+			return ExitConfigError
+		}
 	}
-	if cfg.BackupSchedule != "" {
-		r.scheduleBackup(cfg, env)
+	if cfg.HTTPAddress != "" {
+		r.serveHTTP(cfg)
 	}
-	r.Scheduler.Run()
+	return exitCode(r.Scheduler.Run())
 }
 
 // Shutdown performs a graceful shutdown of rsched.
 func (r *RSched) Shutdown() {
 	r.Scheduler.Shutdown()
+	r.shutdownHTTP()
 }
 
-func (r *RSched) scheduleBackup(cfg Config, env map[string]string) {
-	opts := []restic.Option{restic.WithEnv(env)}
+// Kill kills all running restic processes without waiting for them to
+// complete. It is intended to be called if Shutdown takes too long.
+func (r *RSched) Kill() {
+	r.Scheduler.Kill()
+}
+
+func (r *RSched) scheduleJob(cfg Config, job JobConfig, env map[string]string) error {
+	if err := job.Validate(); err != nil {
+		return err
+	}
+
+	opts := []restic.Option{
+		restic.WithEnv(job.env(env)),
+		restic.WithJobName(job.Name),
+		restic.WithRetryPolicy(job.Retry),
+		restic.WithTimeout(job.Timeout),
+		restic.WithKillGracePeriod(job.KillGracePeriod),
+		restic.WithOverlapPolicy(job.Overlap),
+		restic.WithTimeZone(job.TimeZone),
+		restic.WithStartDelay(job.StartDelay),
+		restic.WithWindows(job.Windows),
+	}
 	if cfg.ResticBinary != "" {
 		opts = append(opts, restic.WithBinary(cfg.ResticBinary))
 	}
+	if err := restic.ValidateOptions(opts...); err != nil {
+		return err
+	}
+
+	for _, s := range []struct {
+		schedule string
+		f        func(JobConfig, []restic.Option) error
+	}{
+		{job.Backup.Schedule, r.scheduleBackup},
+		{job.Forget.Schedule, r.scheduleForget},
+		{job.Prune.Schedule, r.schedulePrune},
+		{job.Check.Schedule, r.scheduleCheck},
+		{job.RestoreDrill.Schedule, r.scheduleRestoreDrill},
+		{job.Pipeline.Schedule, r.schedulePipeline},
+	} {
+		if s.schedule == "" {
+			continue
+		}
+		if err := s.f(job, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *RSched) scheduleBackup(job JobConfig, opts []restic.Option) error {
+	opts = append(opts, backupOptions(job.Backup)...)
+
+	err := r.Scheduler.ScheduleBackup(job.Backup.Schedule, job.Backup.Paths, opts...)
+	if err != nil {
+		return fmt.Errorf("schedule backup: %v", err)
+	}
+	return nil
+}
+
+func (r *RSched) scheduleForget(job JobConfig, opts []restic.Option) error {
+	opts = append(opts, restic.WithForgetPolicy(job.Forget.ForgetPolicy))
+
+	err := r.Scheduler.ScheduleForget(job.Forget.Schedule, opts...)
+	if err != nil {
+		return fmt.Errorf("schedule forget: %v", err)
+	}
+	return nil
+}
+
+func (r *RSched) schedulePrune(job JobConfig, opts []restic.Option) error {
+	opts = append(opts, pruneOptions(job.Prune)...)
+
+	err := r.Scheduler.SchedulePrune(job.Prune.Schedule, opts...)
+	if err != nil {
+		return fmt.Errorf("schedule prune: %v", err)
+	}
+	return nil
+}
+
+func (r *RSched) scheduleCheck(job JobConfig, opts []restic.Option) error {
+	err := r.Scheduler.ScheduleCheck(job.Check.Schedule, job.Check.ReadDataSubsets, opts...)
+	if err != nil {
+		return fmt.Errorf("schedule check: %v", err)
+	}
+	return nil
+}
+
+func (r *RSched) scheduleRestoreDrill(job JobConfig, opts []restic.Option) error {
+	opts = append(opts, restoreDrillOptions(job)...)
+
+	err := r.Scheduler.ScheduleRestoreDrill(job.RestoreDrill.Schedule, opts...)
+	if err != nil {
+		return fmt.Errorf("schedule restore drill: %v", err)
+	}
+	return nil
+}
 
-	err := r.Scheduler.ScheduleBackup(cfg.BackupSchedule, cfg.BackupPath, opts...)
+func (r *RSched) schedulePipeline(job JobConfig, opts []restic.Option) error {
+	steps := make([]restic.PipelineStep, len(job.Pipeline.Steps))
+	for i, sc := range job.Pipeline.Steps {
+		step := restic.PipelineStep{Condition: sc.When}
+		switch sc.Operation {
+		case OperationBackup:
+			step.Kind = restic.KindBackup
+			step.Paths = job.Backup.Paths
+			step.Options = backupOptions(job.Backup)
+		case OperationForget:
+			step.Kind = restic.KindForget
+			step.Options = []restic.Option{restic.WithForgetPolicy(job.Forget.ForgetPolicy)}
+		case OperationPrune:
+			step.Kind = restic.KindPrune
+			step.Options = pruneOptions(job.Prune)
+		case OperationCheck:
+			step.Kind = restic.KindCheck
+			step.Subsets = job.Check.ReadDataSubsets
+		case OperationRestoreDrill:
+			step.Kind = restic.KindRestoreDrill
+			step.Options = restoreDrillOptions(job)
+		default:
+			return fmt.Errorf("schedule pipeline: step %d: unknown operation: %q", i+1, sc.Operation)
+		}
+		steps[i] = step
+	}
+
+	err := r.Scheduler.SchedulePipeline(job.Pipeline.Schedule, steps, opts...)
 	if err != nil {
-		log.Printf("Failed to schedule backup: %v", err)
+		return fmt.Errorf("schedule pipeline: %v", err)
+	}
+	return nil
+}
+
+// backupOptions returns the restic options specific to creating backups.
+func backupOptions(cfg BackupConfig) []restic.Option {
+	opts := []restic.Option{restic.WithInitPolicy(cfg.InitPolicy), restic.WithHooks(cfg.Hooks)}
+
+	if len(cfg.Excludes) > 0 {
+		opts = append(opts, restic.WithExcludes(cfg.Excludes...))
+	}
+	if len(cfg.ExcludeFiles) > 0 {
+		opts = append(opts, restic.WithExcludeFiles(cfg.ExcludeFiles...))
+	}
+	if len(cfg.IExcludes) > 0 {
+		opts = append(opts, restic.WithIExcludes(cfg.IExcludes...))
+	}
+	if cfg.ExcludeCaches {
+		opts = append(opts, restic.WithExcludeCaches())
+	}
+	if len(cfg.ExcludeIfPresent) > 0 {
+		opts = append(opts, restic.WithExcludeIfPresent(cfg.ExcludeIfPresent...))
+	}
+	if cfg.ExcludeLargerThan != "" {
+		opts = append(opts, restic.WithExcludeLargerThan(cfg.ExcludeLargerThan))
+	}
+	if cfg.OneFileSystem {
+		opts = append(opts, restic.WithOneFileSystem())
+	}
+	return opts
+}
+
+// pruneOptions returns the restic options specific to pruning.
+func pruneOptions(cfg PruneConfig) []restic.Option {
+	var opts []restic.Option
+
+	if cfg.MaxUnused != "" {
+		opts = append(opts, restic.WithMaxUnused(cfg.MaxUnused))
+	}
+	if cfg.MaxRepackSize != "" {
+		opts = append(opts, restic.WithMaxRepackSize(cfg.MaxRepackSize))
+	}
+	return opts
+}
+
+// restoreDrillOptions returns the restic options specific to restore drills
+// of job. The drills restore snapshots of the backup paths of job.
+func restoreDrillOptions(job JobConfig) []restic.Option {
+	return []restic.Option{
+		restic.WithDrillPaths(job.Backup.Paths...),
+		restic.WithDrillSampleSize(job.RestoreDrill.SampleSize),
+		restic.WithDrillVerification(job.RestoreDrill.Verification),
+		restic.WithDrillScratchDir(job.RestoreDrill.ScratchDir),
 	}
 }
 
 // ResticScheduler represents the actual restic scheduler.
 type ResticScheduler interface {
-	ScheduleBackup(schedule, path string, os ...restic.Option) error
-	Run()
+	ScheduleBackup(schedule string, paths []string, os ...restic.Option) error
+	ScheduleForget(schedule string, os ...restic.Option) error
+	SchedulePrune(schedule string, os ...restic.Option) error
+	ScheduleCheck(schedule string, subsets int, os ...restic.Option) error
+	ScheduleRestoreDrill(schedule string, os ...restic.Option) error
+	SchedulePipeline(schedule string, steps []restic.PipelineStep, os ...restic.Option) error
+	Run() error
 	Shutdown()
+	Kill()
+	Running() bool
+	LastBackups() map[string]time.Time
+}
+
+// exitCode returns the exit code for the error returned by
+// ResticScheduler.Run.
+func exitCode(err error) int {
+	if err == nil {
+		return ExitSuccess
+	}
+	for _, e := range flattenErrors(err) {
+		if !errors.Is(e, restic.ErrIncompleteBackup) {
+			return ExitFailure
+		}
+	}
+	return ExitIncompleteBackup
+}
+
+// flattenErrors returns all errors joined in err using errors.Join.
+func flattenErrors(err error) []error {
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return []error{err}
+	}
+
+	var errs []error
+	for _, e := range joined.Unwrap() {
+		errs = append(errs, flattenErrors(e)...)
+	}
+	return errs
 }
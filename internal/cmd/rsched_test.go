@@ -1,18 +1,23 @@
 package cmd_test
 
 import (
+	"errors"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/fhofherr/rsched/internal/cmd"
 	"github.com/fhofherr/rsched/internal/restic"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
 
 func TestRSched_Run(t *testing.T) {
 	type testCase struct {
-		name string
-		cfg  cmd.Config
-		mock func(t *testing.T, tt *testCase)
+		name     string
+		cfg      cmd.Config
+		mock     func(t *testing.T, tt *testCase)
+		exitCode int
 
 		// Set during test execution
 		Scheduler *cmd.MockResticScheduler
@@ -28,7 +33,7 @@ func TestRSched_Run(t *testing.T) {
 		{
 			name: "backup only",
 			cfg: cmd.Config{
-				BackupPath:         "/",
+				BackupPaths:        []string{"/"},
 				BackupSchedule:     "@hourly",
 				ResticPasswordFile: "/path/to/password-file",
 				ResticRepository:   "/path/to/repository",
@@ -43,18 +48,420 @@ func TestRSched_Run(t *testing.T) {
 					On(
 						"ScheduleBackup",
 						tt.cfg.BackupSchedule,
-						tt.cfg.BackupPath,
+						tt.cfg.BackupPaths,
 						mock.MatchedBy(
 							restic.MatchOptions(
 								t,
 								restic.WithEnv(env),
+								restic.WithJobName(cmd.DefaultJobName),
 								restic.WithBinary(tt.cfg.ResticBinary),
 							),
 						),
 					).Return(nil)
-				tt.Scheduler.On("Run").Return()
+				tt.Scheduler.On("Run").Return(nil)
 			},
 		},
+		{
+			name: "backup multiple paths with excludes",
+			cfg: cmd.Config{
+				BackupPaths:             []string{"/data", "/home"},
+				BackupSchedule:          "@hourly",
+				BackupExcludes:          []string{"*.tmp"},
+				BackupExcludeFiles:      []string{"/path/to/excludes"},
+				BackupIExcludes:         []string{"*.BAK"},
+				BackupExcludeCaches:     true,
+				BackupExcludeIfPresent:  []string{".nobackup"},
+				BackupExcludeLargerThan: "1G",
+				BackupOneFileSystem:     true,
+				ResticPasswordFile:      "/path/to/password-file",
+				ResticRepository:        "/path/to/repository",
+			},
+			mock: func(t *testing.T, tt *testCase) {
+				env := cmd.Environ()
+				env[restic.EnvResticRepository] = tt.cfg.ResticRepository
+				env[restic.EnvResticPasswordFile] = tt.cfg.ResticPasswordFile
+
+				tt.Scheduler.
+					On(
+						"ScheduleBackup",
+						tt.cfg.BackupSchedule,
+						tt.cfg.BackupPaths,
+						mock.MatchedBy(
+							restic.MatchOptions(
+								t,
+								restic.WithEnv(env),
+								restic.WithJobName(cmd.DefaultJobName),
+								restic.WithExcludes(tt.cfg.BackupExcludes...),
+								restic.WithExcludeFiles(tt.cfg.BackupExcludeFiles...),
+								restic.WithIExcludes(tt.cfg.BackupIExcludes...),
+								restic.WithExcludeCaches(),
+								restic.WithExcludeIfPresent(tt.cfg.BackupExcludeIfPresent...),
+								restic.WithExcludeLargerThan(tt.cfg.BackupExcludeLargerThan),
+								restic.WithOneFileSystem(),
+							),
+						),
+					).Return(nil)
+				tt.Scheduler.On("Run").Return(nil)
+			},
+		},
+		{
+			name: "backup and forget",
+			cfg: cmd.Config{
+				BackupPaths:        []string{"/"},
+				BackupSchedule:     "@hourly",
+				ResticPasswordFile: "/path/to/password-file",
+				ResticRepository:   "/path/to/repository",
+				ForgetSchedule:     "@daily",
+				ForgetPolicy: restic.ForgetPolicy{
+					KeepDaily:  7,
+					KeepWeekly: 4,
+				},
+			},
+			mock: func(t *testing.T, tt *testCase) {
+				env := cmd.Environ()
+				env[restic.EnvResticRepository] = tt.cfg.ResticRepository
+				env[restic.EnvResticPasswordFile] = tt.cfg.ResticPasswordFile
+
+				tt.Scheduler.
+					On(
+						"ScheduleBackup",
+						tt.cfg.BackupSchedule,
+						tt.cfg.BackupPaths,
+						mock.MatchedBy(
+							restic.MatchOptions(t, restic.WithEnv(env), restic.WithJobName(cmd.DefaultJobName)),
+						),
+					).Return(nil)
+				tt.Scheduler.
+					On(
+						"ScheduleForget",
+						tt.cfg.ForgetSchedule,
+						mock.MatchedBy(
+							restic.MatchOptions(
+								t,
+								restic.WithEnv(env),
+								restic.WithJobName(cmd.DefaultJobName),
+								restic.WithForgetPolicy(tt.cfg.ForgetPolicy),
+							),
+						),
+					).Return(nil)
+				tt.Scheduler.On("Run").Return(nil)
+			},
+		},
+		{
+			name: "prune only",
+			cfg: cmd.Config{
+				ResticPasswordFile: "/path/to/password-file",
+				ResticRepository:   "/path/to/repository",
+				PruneSchedule:      "@weekly",
+				PruneMaxUnused:     "10%",
+				PruneMaxRepackSize: "2G",
+			},
+			mock: func(t *testing.T, tt *testCase) {
+				env := cmd.Environ()
+				env[restic.EnvResticRepository] = tt.cfg.ResticRepository
+				env[restic.EnvResticPasswordFile] = tt.cfg.ResticPasswordFile
+
+				tt.Scheduler.
+					On(
+						"SchedulePrune",
+						tt.cfg.PruneSchedule,
+						mock.MatchedBy(
+							restic.MatchOptions(
+								t,
+								restic.WithEnv(env),
+								restic.WithJobName(cmd.DefaultJobName),
+								restic.WithMaxUnused(tt.cfg.PruneMaxUnused),
+								restic.WithMaxRepackSize(tt.cfg.PruneMaxRepackSize),
+							),
+						),
+					).Return(nil)
+				tt.Scheduler.On("Run").Return(nil)
+			},
+		},
+		{
+			name: "check only",
+			cfg: cmd.Config{
+				ResticPasswordFile: "/path/to/password-file",
+				ResticRepository:   "/path/to/repository",
+				CheckSchedule:      "@daily",
+				CheckSubsets:       7,
+			},
+			mock: func(t *testing.T, tt *testCase) {
+				env := cmd.Environ()
+				env[restic.EnvResticRepository] = tt.cfg.ResticRepository
+				env[restic.EnvResticPasswordFile] = tt.cfg.ResticPasswordFile
+
+				tt.Scheduler.
+					On(
+						"ScheduleCheck",
+						tt.cfg.CheckSchedule,
+						tt.cfg.CheckSubsets,
+						mock.MatchedBy(
+							restic.MatchOptions(t, restic.WithEnv(env), restic.WithJobName(cmd.DefaultJobName)),
+						),
+					).Return(nil)
+				tt.Scheduler.On("Run").Return(nil)
+			},
+		},
+		{
+			name: "restore drill only",
+			cfg: cmd.Config{
+				BackupPaths:        []string{"/data", "/home"},
+				ResticPasswordFile: "/path/to/password-file",
+				ResticRepository:   "/path/to/repository",
+				DrillSchedule:      "@weekly",
+				DrillSampleSize:    100,
+				DrillVerification:  restic.DrillVerifyLive,
+			},
+			mock: func(t *testing.T, tt *testCase) {
+				env := cmd.Environ()
+				env[restic.EnvResticRepository] = tt.cfg.ResticRepository
+				env[restic.EnvResticPasswordFile] = tt.cfg.ResticPasswordFile
+
+				tt.Scheduler.
+					On(
+						"ScheduleRestoreDrill",
+						tt.cfg.DrillSchedule,
+						mock.MatchedBy(
+							restic.MatchOptions(
+								t,
+								restic.WithEnv(env),
+								restic.WithJobName(cmd.DefaultJobName),
+								restic.WithDrillPaths(tt.cfg.BackupPaths...),
+								restic.WithDrillSampleSize(tt.cfg.DrillSampleSize),
+								restic.WithDrillVerification(tt.cfg.DrillVerification),
+							),
+						),
+					).Return(nil)
+				tt.Scheduler.On("Run").Return(nil)
+			},
+		},
+		{
+			name: "multiple jobs",
+			cfg: cmd.Config{
+				ResticBinary: "/path/to/restic",
+				Jobs: []cmd.JobConfig{
+					{
+						Name:         "home",
+						Repository:   "/srv/restic/home",
+						PasswordFile: "/etc/rsched/home.password",
+						Retry:        restic.RetryPolicy{MaxAttempts: 3},
+						Timeout:      time.Hour,
+						Overlap:      restic.OverlapConcurrent,
+						TimeZone:     "Europe/Berlin",
+						StartDelay:   restic.StartDelay{Max: 10 * time.Minute},
+						Windows: restic.Windows{
+							Blocked: restic.WindowList{{Start: 9 * time.Hour, End: 17 * time.Hour}},
+						},
+						Backup: cmd.BackupConfig{
+							Schedule: "@hourly",
+							Paths:    []string{"/home"},
+							Excludes: []string{"*.tmp"},
+						},
+						Forget: cmd.ForgetConfig{
+							Schedule:     "@daily",
+							ForgetPolicy: restic.ForgetPolicy{KeepDaily: 7},
+						},
+					},
+					{
+						Name:            "database",
+						RepositoryFile:  "/etc/rsched/database.repository",
+						PasswordCommand: "pass show restic/database",
+						Env:             map[string]string{"AWS_ACCESS_KEY_ID": "some-key-id"},
+						Backup: cmd.BackupConfig{
+							Schedule: "0 3 * * *",
+							Paths:    []string{"/var/backups/postgres"},
+						},
+						Forget: cmd.ForgetConfig{
+							ForgetPolicy: restic.ForgetPolicy{KeepDaily: 14},
+						},
+						Pipeline: cmd.PipelineConfig{
+							Schedule: "0 4 * * *",
+							Steps: []cmd.PipelineStepConfig{
+								{Operation: cmd.OperationBackup},
+								{Operation: cmd.OperationForget},
+								{Operation: cmd.OperationCheck, When: restic.StepAlways},
+							},
+						},
+					},
+				},
+			},
+			mock: func(t *testing.T, tt *testCase) {
+				homeEnv := cmd.Environ()
+				homeEnv[restic.EnvResticRepository] = "/srv/restic/home"
+				homeEnv[restic.EnvResticPasswordFile] = "/etc/rsched/home.password"
+
+				dbEnv := cmd.Environ()
+				dbEnv[restic.EnvResticRepositoryFile] = "/etc/rsched/database.repository"
+				dbEnv[restic.EnvResticPasswordCommand] = "pass show restic/database"
+				dbEnv["AWS_ACCESS_KEY_ID"] = "some-key-id"
+
+				tt.Scheduler.
+					On(
+						"ScheduleBackup",
+						"@hourly",
+						[]string{"/home"},
+						mock.MatchedBy(
+							restic.MatchOptions(
+								t,
+								restic.WithEnv(homeEnv),
+								restic.WithJobName("home"),
+								restic.WithRetryPolicy(restic.RetryPolicy{MaxAttempts: 3}),
+								restic.WithTimeout(time.Hour),
+								restic.WithOverlapPolicy(restic.OverlapConcurrent),
+								restic.WithTimeZone("Europe/Berlin"),
+								restic.WithStartDelay(restic.StartDelay{Max: 10 * time.Minute}),
+								restic.WithWindows(restic.Windows{
+									Blocked: restic.WindowList{{Start: 9 * time.Hour, End: 17 * time.Hour}},
+								}),
+								restic.WithBinary(tt.cfg.ResticBinary),
+								restic.WithExcludes("*.tmp"),
+							),
+						),
+					).Return(nil)
+				tt.Scheduler.
+					On(
+						"ScheduleForget",
+						"@daily",
+						mock.MatchedBy(
+							restic.MatchOptions(
+								t,
+								restic.WithEnv(homeEnv),
+								restic.WithJobName("home"),
+								restic.WithRetryPolicy(restic.RetryPolicy{MaxAttempts: 3}),
+								restic.WithTimeout(time.Hour),
+								restic.WithOverlapPolicy(restic.OverlapConcurrent),
+								restic.WithTimeZone("Europe/Berlin"),
+								restic.WithStartDelay(restic.StartDelay{Max: 10 * time.Minute}),
+								restic.WithWindows(restic.Windows{
+									Blocked: restic.WindowList{{Start: 9 * time.Hour, End: 17 * time.Hour}},
+								}),
+								restic.WithBinary(tt.cfg.ResticBinary),
+								restic.WithForgetPolicy(restic.ForgetPolicy{KeepDaily: 7}),
+							),
+						),
+					).Return(nil)
+				tt.Scheduler.
+					On(
+						"ScheduleBackup",
+						"0 3 * * *",
+						[]string{"/var/backups/postgres"},
+						mock.MatchedBy(
+							restic.MatchOptions(
+								t,
+								restic.WithEnv(dbEnv),
+								restic.WithJobName("database"),
+								restic.WithBinary(tt.cfg.ResticBinary),
+							),
+						),
+					).Return(nil)
+				tt.Scheduler.
+					On(
+						"SchedulePipeline",
+						"0 4 * * *",
+						mock.MatchedBy(
+							restic.MatchPipelineSteps(
+								t,
+								restic.PipelineStep{Kind: restic.KindBackup, Paths: []string{"/var/backups/postgres"}},
+								restic.PipelineStep{
+									Kind: restic.KindForget,
+									Options: []restic.Option{
+										restic.WithForgetPolicy(restic.ForgetPolicy{KeepDaily: 14}),
+									},
+								},
+								restic.PipelineStep{Kind: restic.KindCheck, Condition: restic.StepAlways},
+							),
+						),
+						mock.MatchedBy(
+							restic.MatchOptions(
+								t,
+								restic.WithEnv(dbEnv),
+								restic.WithJobName("database"),
+								restic.WithBinary(tt.cfg.ResticBinary),
+							),
+						),
+					).Return(nil)
+				tt.Scheduler.On("Run").Return(nil)
+			},
+		},
+		{
+			name: "once backup fails",
+			cfg: cmd.Config{
+				BackupPaths:        []string{"/"},
+				BackupSchedule:     restic.ScheduleOnce,
+				ResticPasswordFile: "/path/to/password-file",
+				ResticRepository:   "/path/to/repository",
+			},
+			mock: func(t *testing.T, tt *testCase) {
+				tt.Scheduler.On("ScheduleBackup", restic.ScheduleOnce, tt.cfg.BackupPaths, mock.Anything).Return(nil)
+				tt.Scheduler.On("Run").Return(restic.Error{Command: "backup", ExitCode: 1})
+			},
+			exitCode: cmd.ExitFailure,
+		},
+		{
+			name: "once backup incomplete",
+			cfg: cmd.Config{
+				BackupPaths:        []string{"/"},
+				BackupSchedule:     restic.ScheduleOnce,
+				ResticPasswordFile: "/path/to/password-file",
+				ResticRepository:   "/path/to/repository",
+			},
+			mock: func(t *testing.T, tt *testCase) {
+				tt.Scheduler.On("ScheduleBackup", restic.ScheduleOnce, tt.cfg.BackupPaths, mock.Anything).Return(nil)
+				tt.Scheduler.On("Run").Return(restic.Error{Command: "backup", ExitCode: 3})
+			},
+			exitCode: cmd.ExitIncompleteBackup,
+		},
+		{
+			name: "once backup incomplete and hook failed",
+			cfg: cmd.Config{
+				BackupPaths:        []string{"/"},
+				BackupSchedule:     restic.ScheduleOnce,
+				ResticPasswordFile: "/path/to/password-file",
+				ResticRepository:   "/path/to/repository",
+			},
+			mock: func(t *testing.T, tt *testCase) {
+				tt.Scheduler.On("ScheduleBackup", restic.ScheduleOnce, tt.cfg.BackupPaths, mock.Anything).Return(nil)
+				tt.Scheduler.On("Run").Return(errors.Join(
+					restic.Error{Command: "backup", ExitCode: 3},
+					fmt.Errorf("always hook 0: %w", restic.ErrHookFailed),
+				))
+			},
+			exitCode: cmd.ExitFailure,
+		},
+		{
+			name: "missing repository",
+			cfg: cmd.Config{
+				BackupPaths:        []string{"/"},
+				BackupSchedule:     restic.ScheduleOnce,
+				ResticPasswordFile: "/path/to/password-file",
+			},
+			exitCode: cmd.ExitConfigError,
+		},
+		{
+			name: "missing password",
+			cfg: cmd.Config{
+				BackupPaths:      []string{"/"},
+				BackupSchedule:   restic.ScheduleOnce,
+				ResticRepository: "/path/to/repository",
+			},
+			exitCode: cmd.ExitConfigError,
+		},
+		{
+			name: "schedule fails",
+			cfg: cmd.Config{
+				BackupPaths:        []string{"/"},
+				BackupSchedule:     restic.ScheduleOnce,
+				ResticPasswordFile: "/path/to/password-file",
+				ResticRepository:   "/path/to/repository",
+			},
+			mock: func(t *testing.T, tt *testCase) {
+				tt.Scheduler.
+					On("ScheduleBackup", restic.ScheduleOnce, tt.cfg.BackupPaths, mock.Anything).
+					Return(errors.New("invalid schedule"))
+			},
+			exitCode: cmd.ExitConfigError,
+		},
 	}
 
 	for _, tt := range tests {
@@ -70,8 +477,9 @@ func TestRSched_Run(t *testing.T) {
 			rsched := &cmd.RSched{
 				Scheduler: tt.Scheduler,
 			}
-			rsched.Run(tt.cfg)
+			code := rsched.Run(tt.cfg)
 
+			assert.Equal(t, tt.exitCode, code)
 			tt.Scheduler.AssertExpectations(t)
 		})
 	}
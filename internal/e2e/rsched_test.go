@@ -4,7 +4,6 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
-	"time"
 
 	"github.com/fhofherr/rsched/internal/cmd"
 	"github.com/fhofherr/rsched/internal/restic"
@@ -27,18 +26,13 @@ func TestRschedBackup(t *testing.T) {
 		Scheduler: &restic.Scheduler{},
 	}
 	cfg := cmd.Config{
-		BackupPath:         prjRoot,
+		BackupPaths:        []string{prjRoot},
 		BackupSchedule:     restic.ScheduleOnce,
 		ResticPasswordFile: filepath.Join("testdata", "restic_password_file"),
 		ResticRepository:   repo,
 		ResticBinary:       resticBinary,
 	}
-	go rsched.Run(cfg)
-	defer rsched.Shutdown()
-
-	assert.Eventually(t, func() bool {
-		// TODO: This is a crude way that restic is completed. Maybe we find
-		// something better later on.
-		return testsupport.DirNotEmpty(t, filepath.Join(repo, "snapshots"))
-	}, 15*time.Second, 100*time.Millisecond)
+	code := rsched.Run(cfg)
+	assert.Equal(t, cmd.ExitSuccess, code)
+	assert.True(t, testsupport.DirNotEmpty(t, filepath.Join(repo, "snapshots")))
 }
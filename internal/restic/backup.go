@@ -1,77 +1,189 @@
 package restic
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
-	"os/exec"
+	"time"
 )
 
-// Backup calls restic backup to create a backup.
+// BackupSummary contains the statistics restic reports after creating a
+// backup.
+type BackupSummary struct {
+	SnapshotID          string
+	FilesNew            int
+	FilesChanged        int
+	FilesUnmodified     int
+	DirsNew             int
+	DirsChanged         int
+	DirsUnmodified      int
+	DataBlobs           int
+	TreeBlobs           int
+	DataAdded           uint64
+	TotalFilesProcessed int
+	TotalBytesProcessed uint64
+	TotalDuration       time.Duration
+
+	// ErrorCount is the number of errors restic reported in its last status
+	// message. Those errors usually lead to an incomplete backup.
+	ErrorCount int
+}
+
+// backupMessage represents a single line of the output of restic backup
+// --json. Depending on MessageType only some of the fields are set.
+type backupMessage struct {
+	MessageType string `json:"message_type"`
+
+	// Fields of status messages.
+	ErrorCount int `json:"error_count"`
+
+	// Fields of summary messages.
+	FilesNew            int     `json:"files_new"`
+	FilesChanged        int     `json:"files_changed"`
+	FilesUnmodified     int     `json:"files_unmodified"`
+	DirsNew             int     `json:"dirs_new"`
+	DirsChanged         int     `json:"dirs_changed"`
+	DirsUnmodified      int     `json:"dirs_unmodified"`
+	DataBlobs           int     `json:"data_blobs"`
+	TreeBlobs           int     `json:"tree_blobs"`
+	DataAdded           uint64  `json:"data_added"`
+	TotalFilesProcessed int     `json:"total_files_processed"`
+	TotalBytesProcessed uint64  `json:"total_bytes_processed"`
+	TotalDuration       float64 `json:"total_duration"`
+	SnapshotID          string  `json:"snapshot_id"`
+}
+
+// Backup calls restic backup to create a backup of all paths.
 //
 // repo defines the location of the restic repository. It needs to be in the
 // format defined in the restic documentation
 // (https://restic.readthedocs.io/en/stable/030_preparing_a_new_repo.html).
-// If the repository is not yet initialized Backup initializes a new restic
-// repository. The value of pw is used as the encryption password of the
-// repository.
+// Whether Backup initializes a new restic repository is controlled using
+// WithInitPolicy. By default the repository is initialized if restic reports
+// that it does not exist. The restic password is used as the encryption
+// password of the new repository.
+//
+// Backup returns the summary restic reported for the backup. The summary may
+// be available even if Backup returns an error, e.g. if restic was not able
+// to read some of the files.
+//
+// Hooks executed before and after the backup are passed using WithHooks.
 //
-// Additional options can be passed using opts. Any options not relevant for
-// creating a backup are silently ignored.
-func Backup(ctx context.Context, path string, os ...Option) error {
-	var opts options
+// Additional options can be passed using opts. Files can be excluded from the
+// backup using WithExcludes and its related options. Any options not relevant
+// for creating a backup are silently ignored.
+func Backup(ctx context.Context, paths []string, os ...Option) (BackupSummary, error) {
+	var (
+		opts   options
+		stdout backupOutput
+	)
 
 	if err := opts.Apply(os); err != nil {
-		return fmt.Errorf("backup options: %v", err)
+		return BackupSummary{}, fmt.Errorf("backup options: %v", err)
 	}
 
-	if !repoInitialized(ctx, opts) {
-		if err := initializeRepo(ctx, opts); err != nil {
-			return err // no need to wrap, error already handled by initializeRepo
-		}
+	if err := runBeforeHooks(ctx, opts); err != nil {
+		return BackupSummary{}, joinHookError(err, runAfterHooks(ctx, opts, "", err))
+	}
+	if err := prepareRepo(ctx, opts); err != nil {
+		return BackupSummary{}, joinHookError(err, runAfterHooks(ctx, opts, "", err))
 	}
 
-	cmd := exec.CommandContext(ctx, opts.Restic, "backup", path)
-	cmd.Env = joinEnv(opts.Env)
+	args := append([]string{"backup", "--json"}, opts.backupArgs()...)
+	args = append(args, paths...)
+	err := runResticOutput(ctx, opts, &stdout, args...)
+	summary := stdout.Summary()
+	return summary, joinHookError(err, runAfterHooks(ctx, opts, summary.SnapshotID, err))
+}
 
-	if err := opts.Runner.Run(cmd); err != nil {
-		if err == ctx.Err() {
-			return err
-		}
-		if rErr, ok := asError(err); ok {
-			rErr.Command = "backup"
-			return rErr
-		}
-		return fmt.Errorf("restic backup: %v", err)
+// joinHookError joins the error returned by a backup with the error returned
+// by its after hooks. err is returned unchanged if hookErr is nil.
+func joinHookError(err, hookErr error) error {
+	if hookErr == nil {
+		return err
 	}
+	return errors.Join(err, hookErr)
+}
 
-	return nil
+// backupOutput is an io.Writer parsing the output of restic backup --json
+// line by line. It keeps only the error count of the latest status message
+// and the summary. Lines which are not valid JSON, or are longer than
+// maxLineSize, are ignored. Summary needs to be called once writing is done
+// to parse any incomplete last line.
+type backupOutput struct {
+	summary BackupSummary
+	buf     []byte
+	skip    bool
 }
 
-func repoInitialized(ctx context.Context, opts options) bool {
-	cmd := exec.CommandContext(ctx, opts.Restic, "snapshots")
-	cmd.Env = joinEnv(opts.Env)
+func (o *backupOutput) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			o.append(p)
+			break
+		}
+		o.append(p[:i])
+		o.parseLine()
+		p = p[i+1:]
+	}
+	return n, nil
+}
 
-	if err := opts.Runner.Run(cmd); err != nil {
-		log.Printf("repo initialization check encountered error: %v", err)
-		return false
+// append appends p to the current line. The line is dropped once it
+// exceeds maxLineSize.
+func (o *backupOutput) append(p []byte) {
+	if o.skip {
+		return
 	}
-	return true
+	if len(o.buf)+len(p) > maxLineSize {
+		o.buf, o.skip = o.buf[:0], true
+		return
+	}
+	o.buf = append(o.buf, p...)
 }
 
-func initializeRepo(ctx context.Context, opts options) error {
-	cmd := exec.CommandContext(ctx, opts.Restic, "init")
-	cmd.Env = joinEnv(opts.Env)
+// parseLine parses the current line and starts a new one.
+func (o *backupOutput) parseLine() {
+	defer func() {
+		o.buf, o.skip = o.buf[:0], false
+	}()
 
-	if err := opts.Runner.Run(cmd); err != nil {
-		if err == ctx.Err() {
-			return err
-		}
-		if rErr, ok := asError(err); ok {
-			rErr.Command = "init"
-			return rErr
+	var msg backupMessage
+	if o.skip || json.Unmarshal(o.buf, &msg) != nil {
+		return
+	}
+	switch msg.MessageType {
+	case "status":
+		o.summary.ErrorCount = msg.ErrorCount
+	case "summary":
+		o.summary = BackupSummary{
+			SnapshotID:          msg.SnapshotID,
+			FilesNew:            msg.FilesNew,
+			FilesChanged:        msg.FilesChanged,
+			FilesUnmodified:     msg.FilesUnmodified,
+			DirsNew:             msg.DirsNew,
+			DirsChanged:         msg.DirsChanged,
+			DirsUnmodified:      msg.DirsUnmodified,
+			DataBlobs:           msg.DataBlobs,
+			TreeBlobs:           msg.TreeBlobs,
+			DataAdded:           msg.DataAdded,
+			TotalFilesProcessed: msg.TotalFilesProcessed,
+			TotalBytesProcessed: msg.TotalBytesProcessed,
+			TotalDuration:       time.Duration(msg.TotalDuration * float64(time.Second)),
+			ErrorCount:          o.summary.ErrorCount,
 		}
-		return fmt.Errorf("initialize restic repository: %v", err)
 	}
-	return nil
+}
+
+// Summary parses any incomplete last line and returns the summary of the
+// backup.
+func (o *backupOutput) Summary() BackupSummary {
+	if len(o.buf) > 0 || o.skip {
+		o.parseLine()
+	}
+	return o.summary
 }
@@ -0,0 +1,37 @@
+package restic
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackupOutput(t *testing.T) {
+	var o backupOutput
+
+	for _, s := range []string{
+		`{"message_type":"status","error_count":1}` + "\n",
+		`{"message_type":"sta`,
+		`tus","error_count":2}` + "\n",
+		"not json\n",
+		`{"message_type":"status","current_files":["` + strings.Repeat("a", maxLineSize) + `"]}` + "\n",
+		`{"message_type":"summary","files_new":3,`,
+		`"total_duration":1.5,"snapshot_id":"abc"}`,
+	} {
+		n, err := io.WriteString(&o, s)
+		assert.NoError(t, err)
+		assert.Equal(t, len(s), n)
+	}
+
+	expected := BackupSummary{
+		SnapshotID:    "abc",
+		FilesNew:      3,
+		TotalDuration: 1500 * time.Millisecond,
+		ErrorCount:    2,
+	}
+	assert.Equal(t, expected, o.Summary())
+	assert.LessOrEqual(t, cap(o.buf), maxLineSize)
+}
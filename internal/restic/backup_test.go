@@ -3,6 +3,7 @@ package restic_test
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/fhofherr/rsched/internal/restic"
 	"github.com/stretchr/testify/assert"
@@ -11,18 +12,18 @@ import (
 func TestBackup(t *testing.T) {
 	tests := []restic.TestCase{
 		{
-			Name:       "invalid environment",
-			BackupPath: "/never/backed/up",
+			Name:        "invalid environment",
+			BackupPaths: []string{"/never/backed/up"},
 			Perform: func(t *testing.T, tt *restic.TestCase) {
-				err := restic.Backup(context.Background(), tt.BackupPath, tt.Options...)
+				_, err := restic.Backup(context.Background(), tt.BackupPaths, tt.Options...)
 				assert.Error(t, err)
 			},
 		},
 		{
-			Name:       "repository not yet initialized",
-			Repo:       "/path/to/repository",
-			Password:   "super secret",
-			BackupPath: "/some/path",
+			Name:        "repository not yet initialized",
+			Repo:        "/path/to/repository",
+			Password:    "super secret",
+			BackupPaths: []string{"/some/path"},
 			Invocations: func(t *testing.T, tt *restic.TestCase) []restic.ExpectedInvocation {
 				return []restic.ExpectedInvocation{
 					{
@@ -31,9 +32,10 @@ func TestBackup(t *testing.T) {
 							"RESTIC_REPOSITORY": tt.Repo,
 							"RESTIC_PASSWORD":   tt.Password,
 						},
-						// Restic returns non-zero exit code if repo not initialized or something else went wrong.
-						// TODO: we may wan't to parse restic's output in the future.
+						// Older versions of restic do not use a dedicated exit code.
 						Code: 1,
+						Stderr: "Fatal: unable to open config file: Stat: stat /path/to/repository/config: " +
+							"no such file or directory\nIs there a repository at the following location?\n",
 					},
 					{
 						Args: []string{"restic", "init"},
@@ -43,7 +45,7 @@ func TestBackup(t *testing.T) {
 						},
 					},
 					{
-						Args: []string{"restic", "backup", tt.BackupPath},
+						Args: []string{"restic", "backup", "--json", tt.BackupPaths[0]},
 						Env: map[string]string{
 							"RESTIC_REPOSITORY": tt.Repo,
 							"RESTIC_PASSWORD":   tt.Password,
@@ -53,15 +55,15 @@ func TestBackup(t *testing.T) {
 			},
 			Perform: func(t *testing.T, tt *restic.TestCase) {
 				tt.Options = append(tt.Options, restic.WithRepository(tt.Repo), restic.WithPassword(tt.Password))
-				err := restic.Backup(context.Background(), tt.BackupPath, tt.Options...)
+				_, err := restic.Backup(context.Background(), tt.BackupPaths, tt.Options...)
 				assert.NoError(t, err)
 			},
 		},
 		{
-			Name:       "error during repo initialization",
-			Repo:       "/path/to/repository",
-			Password:   "super secret",
-			BackupPath: "/some/path",
+			Name:        "error during repo initialization",
+			Repo:        "/path/to/repository",
+			Password:    "super secret",
+			BackupPaths: []string{"/some/path"},
 			Invocations: func(t *testing.T, tt *restic.TestCase) []restic.ExpectedInvocation {
 				return []restic.ExpectedInvocation{
 					{
@@ -70,7 +72,7 @@ func TestBackup(t *testing.T) {
 							"RESTIC_REPOSITORY": tt.Repo,
 							"RESTIC_PASSWORD":   tt.Password,
 						},
-						Code: 1,
+						Code: 10,
 					},
 					{
 						Args: []string{"restic", "init"},
@@ -84,7 +86,7 @@ func TestBackup(t *testing.T) {
 			},
 			Perform: func(t *testing.T, tt *restic.TestCase) {
 				tt.Options = append(tt.Options, restic.WithRepository(tt.Repo), restic.WithPassword(tt.Password))
-				err := restic.Backup(context.Background(), tt.BackupPath, tt.Options...)
+				_, err := restic.Backup(context.Background(), tt.BackupPaths, tt.Options...)
 				assert.ErrorIs(t, err, restic.Error{
 					Command:  "init",
 					ExitCode: 1,
@@ -92,10 +94,171 @@ func TestBackup(t *testing.T) {
 			},
 		},
 		{
-			Name:       "repository already initialized",
-			Repo:       "/other/path/to/repository",
-			Password:   "even more secret",
-			BackupPath: "/more/important/data",
+			Name:        "wrong password does not initialize repository",
+			Repo:        "/path/to/repository",
+			Password:    "wrong password",
+			BackupPaths: []string{"/some/path"},
+			Invocations: func(t *testing.T, tt *restic.TestCase) []restic.ExpectedInvocation {
+				return []restic.ExpectedInvocation{
+					{
+						Args: []string{"restic", "snapshots"},
+						Env: map[string]string{
+							"RESTIC_REPOSITORY": tt.Repo,
+							"RESTIC_PASSWORD":   tt.Password,
+						},
+						Code:   1,
+						Stderr: "Fatal: wrong password or no key found\n",
+					},
+				}
+			},
+			Perform: func(t *testing.T, tt *restic.TestCase) {
+				tt.Options = append(tt.Options, restic.WithRepository(tt.Repo), restic.WithPassword(tt.Password))
+				_, err := restic.Backup(context.Background(), tt.BackupPaths, tt.Options...)
+				assert.ErrorIs(t, err, restic.ErrWrongPassword)
+			},
+		},
+		{
+			Name:        "unreachable backend does not initialize repository",
+			Repo:        "s3:https://s3.example.com/bucket",
+			Password:    "super secret",
+			BackupPaths: []string{"/some/path"},
+			Invocations: func(t *testing.T, tt *restic.TestCase) []restic.ExpectedInvocation {
+				return []restic.ExpectedInvocation{
+					{
+						Args: []string{"restic", "snapshots"},
+						Env: map[string]string{
+							"RESTIC_REPOSITORY": tt.Repo,
+							"RESTIC_PASSWORD":   tt.Password,
+						},
+						Code: 1,
+						Stderr: "Fatal: unable to open config file: dial tcp 192.0.2.1:443: " +
+							"connect: connection refused\n" +
+							"Is there a repository at the following location?\n",
+					},
+				}
+			},
+			Perform: func(t *testing.T, tt *restic.TestCase) {
+				tt.Options = append(tt.Options, restic.WithRepository(tt.Repo), restic.WithPassword(tt.Password))
+				_, err := restic.Backup(context.Background(), tt.BackupPaths, tt.Options...)
+				assert.ErrorIs(t, err, restic.ErrBackendUnreachable)
+			},
+		},
+		{
+			Name:        "permission denied does not initialize repository",
+			Repo:        "/path/to/repository",
+			Password:    "super secret",
+			BackupPaths: []string{"/some/path"},
+			Invocations: func(t *testing.T, tt *restic.TestCase) []restic.ExpectedInvocation {
+				return []restic.ExpectedInvocation{
+					{
+						Args: []string{"restic", "snapshots"},
+						Env: map[string]string{
+							"RESTIC_REPOSITORY": tt.Repo,
+							"RESTIC_PASSWORD":   tt.Password,
+						},
+						Code: 1,
+						Stderr: "Fatal: unable to open config file: Stat: stat /path/to/repository/config: " +
+							"permission denied\n" +
+							"Is there a repository at the following location?\n",
+					},
+				}
+			},
+			Perform: func(t *testing.T, tt *restic.TestCase) {
+				tt.Options = append(tt.Options, restic.WithRepository(tt.Repo), restic.WithPassword(tt.Password))
+				_, err := restic.Backup(context.Background(), tt.BackupPaths, tt.Options...)
+				assert.Error(t, err)
+				assert.NotErrorIs(t, err, restic.ErrRepoNotExist)
+			},
+		},
+		{
+			Name:        "init policy never",
+			Repo:        "/path/to/repository",
+			Password:    "super secret",
+			BackupPaths: []string{"/some/path"},
+			Invocations: func(t *testing.T, tt *restic.TestCase) []restic.ExpectedInvocation {
+				return []restic.ExpectedInvocation{
+					{
+						Args: []string{"restic", "backup", "--json", tt.BackupPaths[0]},
+						Env: map[string]string{
+							"RESTIC_REPOSITORY": tt.Repo,
+							"RESTIC_PASSWORD":   tt.Password,
+						},
+					},
+				}
+			},
+			Perform: func(t *testing.T, tt *restic.TestCase) {
+				tt.Options = append(
+					tt.Options,
+					restic.WithRepository(tt.Repo),
+					restic.WithPassword(tt.Password),
+					restic.WithInitPolicy(restic.InitNever),
+				)
+				_, err := restic.Backup(context.Background(), tt.BackupPaths, tt.Options...)
+				assert.NoError(t, err)
+			},
+		},
+		{
+			Name:        "init policy always-check",
+			Repo:        "/path/to/repository",
+			Password:    "super secret",
+			BackupPaths: []string{"/some/path"},
+			Invocations: func(t *testing.T, tt *restic.TestCase) []restic.ExpectedInvocation {
+				return []restic.ExpectedInvocation{
+					{
+						Args: []string{"restic", "snapshots"},
+						Env: map[string]string{
+							"RESTIC_REPOSITORY": tt.Repo,
+							"RESTIC_PASSWORD":   tt.Password,
+						},
+						Code: 10,
+					},
+				}
+			},
+			Perform: func(t *testing.T, tt *restic.TestCase) {
+				tt.Options = append(
+					tt.Options,
+					restic.WithRepository(tt.Repo),
+					restic.WithPassword(tt.Password),
+					restic.WithInitPolicy(restic.InitAlwaysCheck),
+				)
+				_, err := restic.Backup(context.Background(), tt.BackupPaths, tt.Options...)
+				assert.ErrorIs(t, err, restic.ErrRepoNotExist)
+			},
+		},
+		{
+			Name:        "repository already initialized",
+			Repo:        "/other/path/to/repository",
+			Password:    "even more secret",
+			BackupPaths: []string{"/more/important/data"},
+			Invocations: func(t *testing.T, tt *restic.TestCase) []restic.ExpectedInvocation {
+				return []restic.ExpectedInvocation{
+					{
+						Args: []string{"restic", "snapshots"},
+						Env: map[string]string{
+							"RESTIC_REPOSITORY": tt.Repo,
+							"RESTIC_PASSWORD":   tt.Password,
+						},
+					},
+					{
+						Args: []string{"restic", "backup", "--json", tt.BackupPaths[0]},
+						Env: map[string]string{
+							"RESTIC_REPOSITORY": tt.Repo,
+							"RESTIC_PASSWORD":   tt.Password,
+						},
+					},
+				}
+			},
+			Perform: func(t *testing.T, tt *restic.TestCase) {
+				tt.Options = append(tt.Options, restic.WithRepository(tt.Repo), restic.WithPassword(tt.Password))
+				_, err := restic.Backup(context.Background(), tt.BackupPaths, tt.Options...)
+				assert.NoError(t, err)
+			},
+		},
+		{
+			Name:        "parse backup summary",
+			Repo:        "/other/path/to/repository",
+			Password:    "even more secret",
+			BackupPaths: []string{"/more/important/data"},
 			Invocations: func(t *testing.T, tt *restic.TestCase) []restic.ExpectedInvocation {
 				return []restic.ExpectedInvocation{
 					{
@@ -106,25 +269,99 @@ func TestBackup(t *testing.T) {
 						},
 					},
 					{
-						Args: []string{"restic", "backup", tt.BackupPath},
+						Args: []string{"restic", "backup", "--json", tt.BackupPaths[0]},
 						Env: map[string]string{
 							"RESTIC_REPOSITORY": tt.Repo,
 							"RESTIC_PASSWORD":   tt.Password,
 						},
+						Stdout: `{"message_type":"status","percent_done":0,"total_files":1,"total_bytes":10}
+{"message_type":"status","percent_done":1,"total_files":3,"files_done":3,"total_bytes":30,"bytes_done":30}
+{"message_type":"summary","files_new":1,"files_changed":2,"files_unmodified":3,"dirs_new":4,` +
+							`"dirs_changed":5,"dirs_unmodified":6,"data_blobs":7,"tree_blobs":8,"data_added":9,` +
+							`"total_files_processed":10,"total_bytes_processed":11,"total_duration":1.5,` +
+							`"snapshot_id":"abcdef"}
+`,
 					},
 				}
 			},
 			Perform: func(t *testing.T, tt *restic.TestCase) {
 				tt.Options = append(tt.Options, restic.WithRepository(tt.Repo), restic.WithPassword(tt.Password))
-				err := restic.Backup(context.Background(), tt.BackupPath, tt.Options...)
+				summary, err := restic.Backup(context.Background(), tt.BackupPaths, tt.Options...)
+				assert.NoError(t, err)
+				assert.Equal(t, restic.BackupSummary{
+					SnapshotID:          "abcdef",
+					FilesNew:            1,
+					FilesChanged:        2,
+					FilesUnmodified:     3,
+					DirsNew:             4,
+					DirsChanged:         5,
+					DirsUnmodified:      6,
+					DataBlobs:           7,
+					TreeBlobs:           8,
+					DataAdded:           9,
+					TotalFilesProcessed: 10,
+					TotalBytesProcessed: 11,
+					TotalDuration:       1500 * time.Millisecond,
+				}, summary)
+			},
+		},
+		{
+			Name:        "multiple paths and excludes",
+			Repo:        "/other/path/to/repository",
+			Password:    "even more secret",
+			BackupPaths: []string{"/more/important/data", "/even/more/data"},
+			Invocations: func(t *testing.T, tt *restic.TestCase) []restic.ExpectedInvocation {
+				return []restic.ExpectedInvocation{
+					{
+						Args: []string{"restic", "snapshots"},
+						Env: map[string]string{
+							"RESTIC_REPOSITORY": tt.Repo,
+							"RESTIC_PASSWORD":   tt.Password,
+						},
+					},
+					{
+						Args: []string{
+							"restic", "backup", "--json",
+							"--exclude", "*.tmp",
+							"--exclude", "*.log",
+							"--exclude-file", "/path/to/excludes",
+							"--iexclude", "*.BAK",
+							"--exclude-if-present", ".nobackup",
+							"--exclude-caches",
+							"--exclude-larger-than", "1G",
+							"--one-file-system",
+							"/more/important/data", "/even/more/data",
+						},
+						Env: map[string]string{
+							"RESTIC_REPOSITORY": tt.Repo,
+							"RESTIC_PASSWORD":   tt.Password,
+						},
+					},
+				}
+			},
+			Perform: func(t *testing.T, tt *restic.TestCase) {
+				tt.Options = append(
+					tt.Options,
+					restic.WithRepository(tt.Repo),
+					restic.WithPassword(tt.Password),
+					restic.WithExcludes("*.tmp"),
+					restic.WithExcludes("*.log"),
+					restic.WithExcludeFiles("/path/to/excludes"),
+					restic.WithIExcludes("*.BAK"),
+					restic.WithExcludeCaches(),
+					restic.WithExcludeIfPresent(".nobackup"),
+					restic.WithExcludeLargerThan("1G"),
+					restic.WithOneFileSystem(),
+				)
+				_, err := restic.Backup(context.Background(), tt.BackupPaths, tt.Options...)
 				assert.NoError(t, err)
 			},
 		},
 		{
-			Name:       "fatal error during backup",
-			Repo:       "/other/path/to/repository",
-			Password:   "even more secret",
-			BackupPath: "/more/important/data",
+			Name:        "fatal error during backup",
+			Repo:        "/other/path/to/repository",
+			Password:    "even more secret",
+			BackupPaths: []string{"/more/important/data"},
 			Invocations: func(t *testing.T, tt *restic.TestCase) []restic.ExpectedInvocation {
 				return []restic.ExpectedInvocation{
 					{
@@ -135,7 +372,7 @@ func TestBackup(t *testing.T) {
 						},
 					},
 					{
-						Args: []string{"restic", "backup", tt.BackupPath},
+						Args: []string{"restic", "backup", "--json", tt.BackupPaths[0]},
 						Env: map[string]string{
 							"RESTIC_REPOSITORY": tt.Repo,
 							"RESTIC_PASSWORD":   tt.Password,
@@ -146,7 +383,7 @@ func TestBackup(t *testing.T) {
 			},
 			Perform: func(t *testing.T, tt *restic.TestCase) {
 				tt.Options = append(tt.Options, restic.WithRepository(tt.Repo), restic.WithPassword(tt.Password))
-				err := restic.Backup(context.Background(), tt.BackupPath, tt.Options...)
+				_, err := restic.Backup(context.Background(), tt.BackupPaths, tt.Options...)
 				assert.ErrorIs(t, err, restic.Error{
 					Command:  "backup",
 					ExitCode: 1,
@@ -154,10 +391,10 @@ func TestBackup(t *testing.T) {
 			},
 		},
 		{
-			Name:       "incomplete backup",
-			Repo:       "/yet/another/repository",
-			Password:   "secret secret secret",
-			BackupPath: "/really/important/data",
+			Name:        "incomplete backup",
+			Repo:        "/yet/another/repository",
+			Password:    "secret secret secret",
+			BackupPaths: []string{"/really/important/data"},
 			Invocations: func(t *testing.T, tt *restic.TestCase) []restic.ExpectedInvocation {
 				return []restic.ExpectedInvocation{
 					{
@@ -168,18 +405,22 @@ func TestBackup(t *testing.T) {
 						},
 					},
 					{
-						Args: []string{"restic", "backup", tt.BackupPath},
+						Args: []string{"restic", "backup", "--json", tt.BackupPaths[0]},
 						Env: map[string]string{
 							"RESTIC_REPOSITORY": tt.Repo,
 							"RESTIC_PASSWORD":   tt.Password,
 						},
 						Code: 3,
+						Stdout: `{"message_type":"status","percent_done":1,"error_count":2}
+{"message_type":"summary","files_new":1,"snapshot_id":"abcdef"}
+`,
 					},
 				}
 			},
 			Perform: func(t *testing.T, tt *restic.TestCase) {
 				tt.Options = append(tt.Options, restic.WithRepository(tt.Repo), restic.WithPassword(tt.Password))
-				err := restic.Backup(context.Background(), tt.BackupPath, tt.Options...)
+				summary, err := restic.Backup(context.Background(), tt.BackupPaths, tt.Options...)
+				assert.Equal(t, restic.BackupSummary{SnapshotID: "abcdef", FilesNew: 1, ErrorCount: 2}, summary)
 
 				assert.ErrorIs(t, err, restic.Error{
 					Command:  "backup",
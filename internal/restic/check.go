@@ -0,0 +1,25 @@
+package restic
+
+import (
+	"context"
+	"fmt"
+)
+
+// Check calls restic check to verify the integrity of the repository.
+//
+// By default only the structure of the repository is checked. Use
+// WithReadDataSubset to additionally read and verify a subset of the actual
+// data.
+func Check(ctx context.Context, os ...Option) error {
+	var opts options
+
+	if err := opts.Apply(os); err != nil {
+		return fmt.Errorf("check options: %v", err)
+	}
+
+	args := []string{"check"}
+	if opts.ReadDataSubset != "" {
+		args = append(args, "--read-data-subset", opts.ReadDataSubset)
+	}
+	return runRestic(ctx, opts, args...)
+}
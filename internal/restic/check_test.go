@@ -0,0 +1,91 @@
+package restic_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fhofherr/rsched/internal/restic"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []restic.TestCase{
+		{
+			Name:     "check structure only",
+			Repo:     "/path/to/repository",
+			Password: "super secret",
+			Invocations: func(t *testing.T, tt *restic.TestCase) []restic.ExpectedInvocation {
+				return []restic.ExpectedInvocation{
+					{
+						Args: []string{"restic", "check"},
+						Env: map[string]string{
+							"RESTIC_REPOSITORY": tt.Repo,
+							"RESTIC_PASSWORD":   tt.Password,
+						},
+					},
+				}
+			},
+			Perform: func(t *testing.T, tt *restic.TestCase) {
+				tt.Options = append(tt.Options, restic.WithRepository(tt.Repo), restic.WithPassword(tt.Password))
+				err := restic.Check(context.Background(), tt.Options...)
+				assert.NoError(t, err)
+			},
+		},
+		{
+			Name:     "check data subset",
+			Repo:     "/path/to/repository",
+			Password: "super secret",
+			Invocations: func(t *testing.T, tt *restic.TestCase) []restic.ExpectedInvocation {
+				return []restic.ExpectedInvocation{
+					{
+						Args: []string{"restic", "check", "--read-data-subset", "2/5"},
+						Env: map[string]string{
+							"RESTIC_REPOSITORY": tt.Repo,
+							"RESTIC_PASSWORD":   tt.Password,
+						},
+					},
+				}
+			},
+			Perform: func(t *testing.T, tt *restic.TestCase) {
+				tt.Options = append(
+					tt.Options,
+					restic.WithRepository(tt.Repo),
+					restic.WithPassword(tt.Password),
+					restic.WithReadDataSubset("2/5"),
+				)
+				err := restic.Check(context.Background(), tt.Options...)
+				assert.NoError(t, err)
+			},
+		},
+		{
+			Name:     "repository damaged",
+			Repo:     "/path/to/repository",
+			Password: "super secret",
+			Invocations: func(t *testing.T, tt *restic.TestCase) []restic.ExpectedInvocation {
+				return []restic.ExpectedInvocation{
+					{
+						Args: []string{"restic", "check"},
+						Env: map[string]string{
+							"RESTIC_REPOSITORY": tt.Repo,
+							"RESTIC_PASSWORD":   tt.Password,
+						},
+						Code: 1,
+					},
+				}
+			},
+			Perform: func(t *testing.T, tt *restic.TestCase) {
+				tt.Options = append(tt.Options, restic.WithRepository(tt.Repo), restic.WithPassword(tt.Password))
+				err := restic.Check(context.Background(), tt.Options...)
+				assert.ErrorIs(t, err, restic.Error{
+					Command:  "check",
+					ExitCode: 1,
+				})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.Name, tt.Run)
+	}
+}
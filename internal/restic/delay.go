@@ -0,0 +1,55 @@
+package restic
+
+import (
+	"errors"
+	"hash/fnv"
+	"os"
+	"time"
+)
+
+// StartDelay delays the start of each run of a job. This spreads the runs
+// of many hosts sharing the same schedule and storage backend over time.
+//
+// The zero value of StartDelay disables the delay.
+type StartDelay struct {
+	// Max is the maximum delay.
+	Max time.Duration `yaml:"max"`
+
+	// Deterministic derives the delay from a hash of the host name and the
+	// name of the job instead of choosing it randomly for each run. Every
+	// run of the job on the same host is delayed by the same offset.
+	Deterministic bool `yaml:"deterministic"`
+}
+
+// Validate checks if d contains valid values.
+func (d StartDelay) Validate() error {
+	if d.Max < 0 {
+		return errors.New("start delay: negative maximum")
+	}
+	return nil
+}
+
+// hostname returns the name of the host. It is a variable to allow tests to
+// replace it.
+var hostname = os.Hostname
+
+// delay returns the delay before the next run of the job called job. rnd
+// returns a random number in [0, 1).
+func (d StartDelay) delay(job string, rnd func() float64) time.Duration {
+	if d.Max <= 0 {
+		return 0
+	}
+	if !d.Deterministic {
+		return time.Duration(rnd() * float64(d.Max))
+	}
+
+	// The host name is only used to spread the delays of different hosts.
+	// If it is not available all hosts end up with the same delay, which is
+	// no worse than not delaying at all.
+	host, _ := hostname()
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(host))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(job))
+	return time.Duration(h.Sum64() % uint64(d.Max))
+}
@@ -0,0 +1,70 @@
+package restic
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStartDelay_Delay(t *testing.T) {
+	rnd := func() float64 { return 0.25 }
+
+	assert.Equal(t, time.Duration(0), StartDelay{}.delay("test", rnd), "Delay without maximum")
+	assert.Equal(t, 15*time.Minute, StartDelay{Max: time.Hour}.delay("test", rnd), "Random delay")
+
+	d := StartDelay{Max: time.Hour, Deterministic: true}
+	delays := make(map[time.Duration]bool)
+	for _, host := range []string{"host-a", "host-b", "host-c"} {
+		setHostname(t, host)
+		delay := d.delay("test", rnd)
+		assert.Equal(t, delay, d.delay("test", rnd), "Delay of %s not deterministic", host)
+		assert.GreaterOrEqual(t, delay, time.Duration(0))
+		assert.Less(t, delay, d.Max)
+		delays[delay] = true
+	}
+	assert.Len(t, delays, 3, "Hosts share the same delay")
+
+	setHostname(t, "host-a")
+	assert.NotEqual(t, d.delay("test", rnd), d.delay("other", rnd), "Jobs share the same delay")
+}
+
+func TestScheduler_StartDelay_Shutdown(t *testing.T) {
+	setHostname(t, "host-a")
+	d := StartDelay{Max: 24 * time.Hour, Deterministic: true}
+	if !assert.Greater(t, d.delay("test", nil), time.Minute) {
+		return
+	}
+
+	var called bool
+	s := &Scheduler{
+		BackupFunc: func(ctx context.Context, paths []string, os ...Option) (BackupSummary, error) {
+			called = true
+			return BackupSummary{}, nil
+		},
+	}
+	err := s.ScheduleBackup(ScheduleOnce, []string{"/some/path"}, WithJobName("test"), WithStartDelay(d))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	errc := make(chan error)
+	go func() {
+		errc <- s.Run()
+	}()
+	assert.Eventually(t, s.Running, time.Second, time.Millisecond)
+	s.Shutdown()
+	assert.ErrorIs(t, <-errc, context.Canceled)
+	assert.False(t, called, "Job started despite shutdown during start delay")
+}
+
+// setHostname replaces the host name returned by hostname for the duration
+// of the test.
+func setHostname(t *testing.T, name string) {
+	t.Helper()
+
+	orig := hostname
+	hostname = func() (string, error) { return name, nil }
+	t.Cleanup(func() { hostname = orig })
+}
@@ -0,0 +1,331 @@
+package restic
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrDrillMismatch is returned by RestoreDrill if any of the restored files
+// did not pass verification.
+var ErrDrillMismatch = errors.New("restored files do not match")
+
+// DrillVerification defines how RestoreDrill verifies the restored files.
+type DrillVerification int
+
+// Supported values of DrillVerification.
+const (
+	// DrillVerifyRepository makes restic verify the content of the restored
+	// files against the data stored in the repository. Additionally the
+	// sizes of the restored files are compared with the sizes recorded in
+	// the snapshot.
+	DrillVerifyRepository DrillVerification = iota
+
+	// DrillVerifyLive compares the hashes of the restored files with the
+	// hashes of the live files they were backed up from. Live files which
+	// were modified after the snapshot was taken are skipped.
+	DrillVerifyLive
+)
+
+var drillVerificationNames = map[DrillVerification]string{
+	DrillVerifyRepository: "repository",
+	DrillVerifyLive:       "live",
+}
+
+// String returns the name of v.
+func (v DrillVerification) String() string {
+	return drillVerificationNames[v]
+}
+
+// Set sets v to the DrillVerification called name. This allows to use v
+// as a flag.Value.
+func (v *DrillVerification) Set(name string) error {
+	for k, n := range drillVerificationNames {
+		if n == name {
+			*v = k
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown restore drill verification: %q", name)
+}
+
+// UnmarshalText sets v to the DrillVerification called text.
+func (v *DrillVerification) UnmarshalText(text []byte) error {
+	return v.Set(string(text))
+}
+
+// DrillReport contains the results of a restore drill.
+type DrillReport struct {
+	SnapshotID string
+	Restored   int
+	Verified   int
+	Skipped    int
+	Mismatches []DrillMismatch
+}
+
+// DrillMismatch describes a file which did not pass verification.
+type DrillMismatch struct {
+	Path   string
+	Reason string
+}
+
+// RestoreDrill restores the latest snapshot into a scratch directory and
+// verifies the restored files.
+//
+// Only snapshots created on the current host are considered. The paths of
+// the snapshot are passed using WithDrillPaths. Otherwise the latest
+// snapshot of any paths is restored.
+//
+// By default all files in the snapshot are restored. WithDrillSampleSize
+// allows to restore a random sample of files instead. The scratch directory
+// can be set using WithDrillScratchDir. It must either not exist or be
+// empty. If no scratch directory is passed RestoreDrill creates a temporary
+// directory. The scratch directory is removed once the drill is completed.
+//
+// How the restored files are verified is selected using
+// WithDrillVerification. RestoreDrill returns an error wrapping
+// ErrDrillMismatch if any file does not pass verification. The returned
+// DrillReport lists all files failing verification.
+func RestoreDrill(ctx context.Context, os ...Option) (DrillReport, error) {
+	var (
+		opts   options
+		report DrillReport
+	)
+
+	if err := opts.Apply(os); err != nil {
+		return report, fmt.Errorf("restore drill options: %v", err)
+	}
+
+	snapshot, files, err := listLatest(ctx, opts)
+	if err != nil {
+		return report, err
+	}
+	report.SnapshotID = snapshot.ID
+
+	scratchDir, err := makeScratchDir(opts.DrillScratchDir)
+	if err != nil {
+		return report, fmt.Errorf("restore drill: %v", err)
+	}
+	defer func() {
+		if err := removeAll(scratchDir); err != nil {
+			logger(ctx).Warn("Failed to remove restore drill scratch directory", "error", err)
+		}
+	}()
+
+	args := []string{"restore", snapshot.ID, "--target", scratchDir}
+	if opts.DrillVerification == DrillVerifyRepository {
+		args = append(args, "--verify")
+	}
+	if opts.DrillSampleSize > 0 && opts.DrillSampleSize < len(files) {
+		files = sampleFiles(files, opts.DrillSampleSize)
+		for _, f := range files {
+			args = append(args, "--include", escapeGlob(f.Path))
+		}
+	}
+	if err := runRestic(ctx, opts, args...); err != nil {
+		return report, err
+	}
+
+	setPhase(ctx, "verify")
+	for _, f := range files {
+		report.verify(scratchDir, f, opts.DrillVerification)
+	}
+	if len(report.Mismatches) > 0 {
+		return report, fmt.Errorf("restore drill: %w: %d files", ErrDrillMismatch, len(report.Mismatches))
+	}
+	return report, nil
+}
+
+func (r *DrillReport) verify(scratchDir string, f lsNode, v DrillVerification) {
+	restored := filepath.Join(scratchDir, f.Path)
+
+	fi, err := os.Stat(restored)
+	if err != nil {
+		r.mismatch(f.Path, fmt.Sprintf("not restored: %v", err))
+		return
+	}
+	r.Restored++
+	if uint64(fi.Size()) != f.Size {
+		r.mismatch(f.Path, fmt.Sprintf("size %d does not match snapshot size %d", fi.Size(), f.Size))
+		return
+	}
+	if v == DrillVerifyRepository {
+		// The actual content was already verified by restic.
+		r.Verified++
+		return
+	}
+
+	live, err := os.Stat(f.Path)
+	if err != nil || !live.ModTime().Equal(f.ModTime) || uint64(live.Size()) != f.Size {
+		// The live file was removed or modified after the snapshot was
+		// taken. Comparing it would lead to false positives.
+		r.Skipped++
+		return
+	}
+	restoredHash, err := hashFile(restored)
+	if err != nil {
+		r.mismatch(f.Path, err.Error())
+		return
+	}
+	liveHash, err := hashFile(f.Path)
+	if err != nil {
+		r.mismatch(f.Path, err.Error())
+		return
+	}
+	if !bytes.Equal(restoredHash, liveHash) {
+		r.mismatch(f.Path, fmt.Sprintf("hash %x does not match live hash %x", restoredHash, liveHash))
+		return
+	}
+	r.Verified++
+}
+
+func (r *DrillReport) mismatch(path, reason string) {
+	r.Mismatches = append(r.Mismatches, DrillMismatch{Path: path, Reason: reason})
+}
+
+type lsSnapshot struct {
+	ID string `json:"id"`
+}
+
+type lsNode struct {
+	Type    string    `json:"type"`
+	Path    string    `json:"path"`
+	Size    uint64    `json:"size"`
+	ModTime time.Time `json:"mtime"`
+}
+
+// listLatest calls restic ls --json to obtain the latest snapshot of
+// opts.DrillPaths created on this host and all regular files contained
+// within.
+func listLatest(ctx context.Context, opts options) (lsSnapshot, []lsNode, error) {
+	var (
+		stdout   bytes.Buffer
+		snapshot lsSnapshot
+		files    []lsNode
+	)
+
+	host, err := os.Hostname()
+	if err != nil {
+		return snapshot, nil, fmt.Errorf("restic ls: %v", err)
+	}
+	args := []string{"ls", "latest", "--json", "--host", host}
+	for _, p := range opts.DrillPaths {
+		args = append(args, "--path", p)
+	}
+	if err := runResticOutput(ctx, opts, &stdout, args...); err != nil {
+		return snapshot, nil, err
+	}
+
+	sc := bufio.NewScanner(&stdout)
+	for sc.Scan() {
+		var msg struct {
+			StructType string `json:"struct_type"`
+		}
+
+		line := sc.Bytes()
+		if err := json.Unmarshal(line, &msg); err != nil {
+			return snapshot, nil, fmt.Errorf("restic ls: parse output: %v", err)
+		}
+		switch msg.StructType {
+		case "snapshot":
+			if err := json.Unmarshal(line, &snapshot); err != nil {
+				return snapshot, nil, fmt.Errorf("restic ls: parse snapshot: %v", err)
+			}
+		case "node":
+			var n lsNode
+
+			if err := json.Unmarshal(line, &n); err != nil {
+				return snapshot, nil, fmt.Errorf("restic ls: parse node: %v", err)
+			}
+			if n.Type == "file" {
+				files = append(files, n)
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return snapshot, nil, fmt.Errorf("restic ls: read output: %v", err)
+	}
+	if snapshot.ID == "" {
+		return snapshot, nil, errors.New("restic ls: no snapshot found")
+	}
+	return snapshot, files, nil
+}
+
+func sampleFiles(files []lsNode, n int) []lsNode {
+	// Not used for anything security related.
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano())) // nolint: gosec
+
+	sample := make([]lsNode, len(files))
+	copy(sample, files)
+	rnd.Shuffle(len(sample), func(i, j int) {
+		sample[i], sample[j] = sample[j], sample[i]
+	})
+	return sample[:n]
+}
+
+// globReplacer escapes the characters restic interprets in include
+// patterns.
+var globReplacer = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`)
+
+// escapeGlob escapes path for use as a pattern matching exactly path, e.g.
+// in restore --include.
+func escapeGlob(path string) string {
+	return globReplacer.Replace(path)
+}
+
+func makeScratchDir(dir string) (string, error) {
+	if dir == "" {
+		return os.MkdirTemp("", "rsched-drill-")
+	}
+	es, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return dir, os.MkdirAll(dir, 0o700)
+	}
+	if err != nil {
+		return "", err
+	}
+	if len(es) > 0 {
+		return "", fmt.Errorf("scratch directory not empty: %s", dir)
+	}
+	return dir, nil
+}
+
+// removeAll removes dir and everything within. Restored directories may be
+// read-only, which is why removeAll makes all directories writable first.
+func removeAll(dir string) error {
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return err
+		}
+		return os.Chmod(path, 0o700)
+	})
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+func hashFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,47 @@
+package restic
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSampleFiles(t *testing.T) {
+	files := make([]lsNode, 10)
+	for i := range files {
+		files[i] = lsNode{Type: "file", Path: fmt.Sprintf("/data/%d", i)}
+	}
+
+	sample := sampleFiles(files, 3)
+	assert.Len(t, sample, 3)
+	assert.Subset(t, files, sample)
+
+	seen := make(map[string]bool)
+	for _, f := range sample {
+		assert.False(t, seen[f.Path], "file sampled twice: %s", f.Path)
+		seen[f.Path] = true
+	}
+}
+
+func TestEscapeGlob(t *testing.T) {
+	paths := []string{
+		"/data/plain",
+		"/data/a*b",
+		"/data/what?",
+		"/data/[draft] notes",
+		`/data/back\slash`,
+	}
+
+	for _, path := range paths {
+		pattern := escapeGlob(path)
+		ok, err := filepath.Match(pattern, path)
+		assert.NoError(t, err, pattern)
+		assert.True(t, ok, "Pattern %q does not match %q", pattern, path)
+
+		ok, _ = filepath.Match(pattern, path+"x")
+		assert.False(t, ok, "Pattern %q matches %q", pattern, path+"x")
+	}
+	assert.Equal(t, `/data/\[draft] notes`, escapeGlob("/data/[draft] notes"))
+}
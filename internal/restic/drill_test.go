@@ -0,0 +1,302 @@
+package restic_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fhofherr/rsched/internal/restic"
+	"github.com/fhofherr/rsched/internal/testsupport"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRestoreDrill(t *testing.T) {
+	mtime := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	lsOutput := func(files map[string]string) string {
+		var sb strings.Builder
+
+		fmt.Fprintln(&sb, `{"time":"2022-06-01T12:00:00Z","paths":["/data"],"id":"abcdef","struct_type":"snapshot"}`)
+		fmt.Fprintln(&sb, `{"name":"data","type":"dir","path":"/data","struct_type":"node"}`)
+		for path, content := range files {
+			fmt.Fprintf(
+				&sb,
+				`{"name":%q,"type":"file","path":%q,"size":%d,"mtime":%q,"struct_type":"node"}`+"\n",
+				filepath.Base(path), path, len(content), mtime.Format(time.RFC3339Nano),
+			)
+		}
+		return sb.String()
+	}
+	restoreFiles := func(files map[string]string) func(t *testing.T, cmd *exec.Cmd) {
+		return func(t *testing.T, cmd *exec.Cmd) {
+			target := cmd.Args[4]
+			for path, content := range files {
+				writeFile(t, filepath.Join(target, path), content, mtime)
+			}
+		}
+	}
+
+	tests := []restic.TestCase{
+		{
+			Name:     "verify against repository",
+			Repo:     "/path/to/repository",
+			Password: "super secret",
+			Invocations: func(t *testing.T, tt *restic.TestCase) []restic.ExpectedInvocation {
+				files := map[string]string{"/data/a": "content a", "/data/b": "content b"}
+				return []restic.ExpectedInvocation{
+					{
+						Args: []string{"restic", "ls", "latest", "--json", "--host", hostname(t)},
+						Env: map[string]string{
+							"RESTIC_REPOSITORY": tt.Repo,
+							"RESTIC_PASSWORD":   tt.Password,
+						},
+						Stdout: lsOutput(files),
+					},
+					{
+						Args: []string{"restic", "restore", "abcdef", "--target", tt.ScratchDir, "--verify"},
+						Env: map[string]string{
+							"RESTIC_REPOSITORY": tt.Repo,
+							"RESTIC_PASSWORD":   tt.Password,
+						},
+						Effect: restoreFiles(files),
+					},
+				}
+			},
+			Perform: func(t *testing.T, tt *restic.TestCase) {
+				tt.Options = append(
+					tt.Options,
+					restic.WithRepository(tt.Repo),
+					restic.WithPassword(tt.Password),
+					restic.WithDrillScratchDir(tt.ScratchDir),
+				)
+				report, err := restic.RestoreDrill(context.Background(), tt.Options...)
+				assert.NoError(t, err)
+				assert.Equal(t, restic.DrillReport{SnapshotID: "abcdef", Restored: 2, Verified: 2}, report)
+			},
+			Assert: func(t *testing.T, tt *restic.TestCase) {
+				assert.False(t, testsupport.PathExists(t, tt.ScratchDir), "scratch directory not removed")
+			},
+		},
+		{
+			Name:     "latest snapshot of backup paths",
+			Repo:     "/path/to/repository",
+			Password: "super secret",
+			Invocations: func(t *testing.T, tt *restic.TestCase) []restic.ExpectedInvocation {
+				files := map[string]string{"/data/a": "content a"}
+				return []restic.ExpectedInvocation{
+					{
+						Args: []string{
+							"restic", "ls", "latest", "--json",
+							"--host", hostname(t), "--path", "/data", "--path", "/home",
+						},
+						Env: map[string]string{
+							"RESTIC_REPOSITORY": tt.Repo,
+							"RESTIC_PASSWORD":   tt.Password,
+						},
+						Stdout: lsOutput(files),
+					},
+					{
+						Args: []string{"restic", "restore", "abcdef", "--target", tt.ScratchDir, "--verify"},
+						Env: map[string]string{
+							"RESTIC_REPOSITORY": tt.Repo,
+							"RESTIC_PASSWORD":   tt.Password,
+						},
+						Effect: restoreFiles(files),
+					},
+				}
+			},
+			Perform: func(t *testing.T, tt *restic.TestCase) {
+				tt.Options = append(
+					tt.Options,
+					restic.WithRepository(tt.Repo),
+					restic.WithPassword(tt.Password),
+					restic.WithDrillScratchDir(tt.ScratchDir),
+					restic.WithDrillPaths("/data", "/home"),
+				)
+				report, err := restic.RestoreDrill(context.Background(), tt.Options...)
+				assert.NoError(t, err)
+				assert.Equal(t, restic.DrillReport{SnapshotID: "abcdef", Restored: 1, Verified: 1}, report)
+			},
+		},
+		{
+			Name:     "file missing in restore",
+			Repo:     "/path/to/repository",
+			Password: "super secret",
+			Invocations: func(t *testing.T, tt *restic.TestCase) []restic.ExpectedInvocation {
+				return []restic.ExpectedInvocation{
+					{
+						Args: []string{"restic", "ls", "latest", "--json", "--host", hostname(t)},
+						Env: map[string]string{
+							"RESTIC_REPOSITORY": tt.Repo,
+							"RESTIC_PASSWORD":   tt.Password,
+						},
+						Stdout: lsOutput(map[string]string{"/data/a": "content a", "/data/b": "content b"}),
+					},
+					{
+						Args: []string{"restic", "restore", "abcdef", "--target", tt.ScratchDir, "--verify"},
+						Env: map[string]string{
+							"RESTIC_REPOSITORY": tt.Repo,
+							"RESTIC_PASSWORD":   tt.Password,
+						},
+						Effect: restoreFiles(map[string]string{"/data/a": "content a"}),
+					},
+				}
+			},
+			Perform: func(t *testing.T, tt *restic.TestCase) {
+				tt.Options = append(
+					tt.Options,
+					restic.WithRepository(tt.Repo),
+					restic.WithPassword(tt.Password),
+					restic.WithDrillScratchDir(tt.ScratchDir),
+				)
+				report, err := restic.RestoreDrill(context.Background(), tt.Options...)
+				assert.ErrorIs(t, err, restic.ErrDrillMismatch)
+				if assert.Len(t, report.Mismatches, 1) {
+					assert.Equal(t, "/data/b", report.Mismatches[0].Path)
+				}
+			},
+		},
+		{
+			Name:     "error during restore",
+			Repo:     "/path/to/repository",
+			Password: "super secret",
+			Invocations: func(t *testing.T, tt *restic.TestCase) []restic.ExpectedInvocation {
+				return []restic.ExpectedInvocation{
+					{
+						Args: []string{"restic", "ls", "latest", "--json", "--host", hostname(t)},
+						Env: map[string]string{
+							"RESTIC_REPOSITORY": tt.Repo,
+							"RESTIC_PASSWORD":   tt.Password,
+						},
+						Stdout: lsOutput(map[string]string{"/data/a": "content a"}),
+					},
+					{
+						Args: []string{"restic", "restore", "abcdef", "--target", tt.ScratchDir, "--verify"},
+						Env: map[string]string{
+							"RESTIC_REPOSITORY": tt.Repo,
+							"RESTIC_PASSWORD":   tt.Password,
+						},
+						Code: 1,
+					},
+				}
+			},
+			Perform: func(t *testing.T, tt *restic.TestCase) {
+				tt.Options = append(
+					tt.Options,
+					restic.WithRepository(tt.Repo),
+					restic.WithPassword(tt.Password),
+					restic.WithDrillScratchDir(tt.ScratchDir),
+				)
+				_, err := restic.RestoreDrill(context.Background(), tt.Options...)
+				assert.ErrorIs(t, err, restic.Error{
+					Command:  "restore",
+					ExitCode: 1,
+				})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		tt.ScratchDir = filepath.Join(testsupport.TempDir(t), "scratch")
+		t.Run(tt.Name, tt.Run)
+	}
+}
+
+func TestRestoreDrill_VerifyLive(t *testing.T) {
+	mtime := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	liveDir := testsupport.TempDir(t)
+	scratchDir := filepath.Join(testsupport.TempDir(t), "scratch")
+
+	unchanged := filepath.Join(liveDir, "unchanged")
+	corrupted := filepath.Join(liveDir, "corrupted")
+	modified := filepath.Join(liveDir, "modified")
+	writeFile(t, unchanged, "unchanged", mtime)
+	writeFile(t, corrupted, "corrupted", mtime)
+	writeFile(t, modified, "modified later", mtime.Add(time.Hour))
+
+	var stdout strings.Builder
+	fmt.Fprintln(&stdout, `{"id":"abcdef","struct_type":"snapshot"}`)
+	for _, path := range []string{unchanged, corrupted, modified} {
+		fmt.Fprintf(
+			&stdout,
+			`{"type":"file","path":%q,"size":%d,"mtime":%q,"struct_type":"node"}`+"\n",
+			path, len(filepath.Base(path)), mtime.Format(time.RFC3339Nano),
+		)
+	}
+
+	tt := restic.TestCase{
+		Repo:     "/path/to/repository",
+		Password: "super secret",
+		Invocations: func(t *testing.T, tt *restic.TestCase) []restic.ExpectedInvocation {
+			return []restic.ExpectedInvocation{
+				{
+					Args: []string{"restic", "ls", "latest", "--json", "--host", hostname(t)},
+					Env: map[string]string{
+						"RESTIC_REPOSITORY": tt.Repo,
+						"RESTIC_PASSWORD":   tt.Password,
+					},
+					Stdout: stdout.String(),
+				},
+				{
+					Args: []string{"restic", "restore", "abcdef", "--target", scratchDir},
+					Env: map[string]string{
+						"RESTIC_REPOSITORY": tt.Repo,
+						"RESTIC_PASSWORD":   tt.Password,
+					},
+					Effect: func(t *testing.T, cmd *exec.Cmd) {
+						writeFile(t, filepath.Join(scratchDir, unchanged), "unchanged", mtime)
+						writeFile(t, filepath.Join(scratchDir, corrupted), "CORRUPTED", mtime)
+						writeFile(t, filepath.Join(scratchDir, modified), "modified", mtime)
+					},
+				},
+			}
+		},
+		Perform: func(t *testing.T, tt *restic.TestCase) {
+			tt.Options = append(
+				tt.Options,
+				restic.WithRepository(tt.Repo),
+				restic.WithPassword(tt.Password),
+				restic.WithDrillScratchDir(scratchDir),
+				restic.WithDrillVerification(restic.DrillVerifyLive),
+			)
+			report, err := restic.RestoreDrill(context.Background(), tt.Options...)
+			assert.ErrorIs(t, err, restic.ErrDrillMismatch)
+			assert.Equal(t, 3, report.Restored)
+			assert.Equal(t, 1, report.Verified)
+			assert.Equal(t, 1, report.Skipped)
+			if assert.Len(t, report.Mismatches, 1) {
+				assert.Equal(t, corrupted, report.Mismatches[0].Path)
+			}
+		},
+	}
+	tt.Run(t)
+}
+
+func hostname(t *testing.T) string {
+	t.Helper()
+
+	host, err := os.Hostname()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return host
+}
+
+func writeFile(t *testing.T, path, content string, mtime time.Time) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
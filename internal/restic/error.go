@@ -1,11 +1,102 @@
 package restic
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"strings"
 )
 
+// Sentinel errors describing the class of an Error. Use errors.Is to check
+// if an error belongs to any of these classes.
+var (
+	ErrRepoNotExist       = errors.New("repository does not exist")
+	ErrWrongPassword      = errors.New("wrong password")
+	ErrRepoLocked         = errors.New("repository is locked")
+	ErrIncompleteBackup   = errors.New("incomplete backup")
+	ErrInterrupted        = errors.New("interrupted")
+	ErrBackendUnreachable = errors.New("backend unreachable")
+	ErrTimeout            = errors.New("timed out")
+	ErrKilled             = errors.New("killed")
+	ErrWindowClosed       = errors.New("window closed")
+)
+
+// Exit codes documented by restic
+// (https://restic.readthedocs.io/en/stable/075_scripting.html#exit-codes).
+// Older versions of restic exit with code 1 for all fatal errors, except for
+// incomplete backups. Those failures are classified by looking at restic's
+// stderr.
+const (
+	exitCodeIncompleteBackup = 3
+	exitCodeRepoNotExist     = 10
+	exitCodeRepoLocked       = 11
+	exitCodeWrongPassword    = 12
+	exitCodeInterrupted      = 130
+)
+
+var exitCodeClasses = map[int]error{
+	exitCodeIncompleteBackup: ErrIncompleteBackup,
+	exitCodeRepoNotExist:     ErrRepoNotExist,
+	exitCodeRepoLocked:       ErrRepoLocked,
+	exitCodeWrongPassword:    ErrWrongPassword,
+	exitCodeInterrupted:      ErrInterrupted,
+}
+
+// stderrClasses maps the error classes to messages restic writes to stderr
+// if an error of the class occurs. The order of the entries matters, as the
+// messages of some errors may contain the messages of others. In particular
+// restic asks "Is there a repository at the following location?" after any
+// failure to open the config file of the repository, including an
+// unreachable backend or missing permissions. An entry with requires only
+// matches if stderr additionally contains any of the required messages.
+var stderrClasses = []struct {
+	class    error
+	patterns []string
+	requires []string
+}{
+	{ErrInterrupted, []string{"signal interrupt received", "signal terminated received"}, nil},
+	{ErrWrongPassword, []string{"wrong password or no key found"}, nil},
+	{ErrBackendUnreachable, []string{
+		"connection refused",
+		"connection reset by peer",
+		"no such host",
+		"network is unreachable",
+		"no route to host",
+		"i/o timeout",
+		"TLS handshake timeout",
+	}, nil},
+	{ErrRepoNotExist, []string{"repository does not exist"}, nil},
+	{ErrRepoNotExist, []string{"Is there a repository at the following location?"}, []string{
+		"does not exist",
+		"no such file or directory",
+		"NoSuchKey",
+		"404",
+	}},
+	{ErrRepoLocked, []string{"repository is already locked", "unable to create lock in backend"}, nil},
+}
+
+// errorClassNames contains the names returned by ErrorClass. If an error
+// belongs to several classes, e.g. because it joins multiple errors, the
+// first matching entry wins.
+//
+// ErrTimeout, ErrWindowClosed, and ErrKilled come first, as they describe
+// why restic failed with the error it reported.
+var errorClassNames = []struct {
+	class error
+	name  string
+}{
+	{ErrTimeout, "timeout"},
+	{ErrWindowClosed, "window_closed"},
+	{ErrKilled, "killed"},
+	{ErrRepoNotExist, "repo_not_exist"},
+	{ErrWrongPassword, "wrong_password"},
+	{ErrRepoLocked, "repo_locked"},
+	{ErrIncompleteBackup, "incomplete_backup"},
+	{ErrInterrupted, "interrupted"},
+	{ErrBackendUnreachable, "backend_unreachable"},
+	{ErrHookFailed, "hook_failed"},
+}
+
 // Error represents an error that occurred while interacting with restic.
 type Error struct {
 	Command  string
@@ -23,10 +114,67 @@ func (e Error) Error() string {
 	if e.ExitCode > 0 {
 		fmt.Fprintf(&sb, ": exit code: %d", e.ExitCode)
 	}
+	if class := e.class(); class != nil {
+		fmt.Fprintf(&sb, ": %v", class)
+	}
 
 	return sb.String()
 }
 
+// Is returns true if target is the sentinel error describing the class of e.
+func (e Error) Is(target error) bool {
+	class := e.class()
+	return class != nil && class == target
+}
+
+// class returns the sentinel error describing the class of e, or nil if e
+// could not be classified.
+func (e Error) class() error {
+	if class, ok := exitCodeClasses[e.ExitCode]; ok {
+		return class
+	}
+	for _, sc := range stderrClasses {
+		if containsAny(e.Stderr, sc.patterns) && (sc.requires == nil || containsAny(e.Stderr, sc.requires)) {
+			return sc.class
+		}
+	}
+	return nil
+}
+
+// containsAny returns true if s contains any of substrs.
+func containsAny(s string, substrs []string) bool {
+	for _, sub := range substrs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrorClass returns a short name for the class of err.
+//
+// The name is suitable to be used in log messages or as the label of a
+// metric. ErrorClass returns an empty string if err is nil, "canceled" if err
+// is caused by a canceled context, "restic" for an Error that could not be
+// classified and "other" for any other error.
+func ErrorClass(err error) string {
+	if err == nil {
+		return ""
+	}
+	for _, cn := range errorClassNames {
+		if errors.Is(err, cn.class) {
+			return cn.name
+		}
+	}
+	if errors.Is(err, context.Canceled) {
+		return "canceled"
+	}
+	if _, ok := asError(err); ok {
+		return "restic"
+	}
+	return "other"
+}
+
 func asError(err error) (Error, bool) {
 	var rErr Error
 
@@ -0,0 +1,198 @@
+package restic_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/fhofherr/rsched/internal/restic"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestError_Is(t *testing.T) {
+	sentinels := []error{
+		restic.ErrRepoNotExist,
+		restic.ErrWrongPassword,
+		restic.ErrRepoLocked,
+		restic.ErrIncompleteBackup,
+		restic.ErrInterrupted,
+		restic.ErrBackendUnreachable,
+	}
+
+	tests := []struct {
+		name     string
+		err      error
+		expected error
+		class    string
+	}{
+		{
+			name:  "unclassified fatal error",
+			err:   restic.Error{Command: "backup", ExitCode: 1, Stderr: "Fatal: something went wrong"},
+			class: "restic",
+		},
+		{
+			name:     "incomplete backup",
+			err:      restic.Error{Command: "backup", ExitCode: 3},
+			expected: restic.ErrIncompleteBackup,
+			class:    "incomplete_backup",
+		},
+		{
+			name:     "repository does not exist exit code",
+			err:      restic.Error{Command: "snapshots", ExitCode: 10},
+			expected: restic.ErrRepoNotExist,
+			class:    "repo_not_exist",
+		},
+		{
+			name:     "repository locked exit code",
+			err:      restic.Error{Command: "prune", ExitCode: 11},
+			expected: restic.ErrRepoLocked,
+			class:    "repo_locked",
+		},
+		{
+			name:     "wrong password exit code",
+			err:      restic.Error{Command: "snapshots", ExitCode: 12},
+			expected: restic.ErrWrongPassword,
+			class:    "wrong_password",
+		},
+		{
+			name:     "interrupted exit code",
+			err:      restic.Error{Command: "backup", ExitCode: 130},
+			expected: restic.ErrInterrupted,
+			class:    "interrupted",
+		},
+		{
+			name: "repository does not exist stderr",
+			err: restic.Error{
+				Command:  "snapshots",
+				ExitCode: 1,
+				Stderr: "Fatal: unable to open config file: Stat: stat /srv/repo/config: no such file or directory\n" +
+					"Is there a repository at the following location?\n/srv/repo\n",
+			},
+			expected: restic.ErrRepoNotExist,
+			class:    "repo_not_exist",
+		},
+		{
+			name: "repository does not exist in s3 stderr",
+			err: restic.Error{
+				Command:  "snapshots",
+				ExitCode: 1,
+				Stderr: "Fatal: unable to open config file: Stat: The specified key does not exist.\n" +
+					"Is there a repository at the following location?\ns3:https://s3.example.com/bucket\n",
+			},
+			expected: restic.ErrRepoNotExist,
+			class:    "repo_not_exist",
+		},
+		{
+			name: "permission denied stderr",
+			err: restic.Error{
+				Command:  "snapshots",
+				ExitCode: 1,
+				Stderr: "Fatal: unable to open config file: Stat: stat /srv/repo/config: permission denied\n" +
+					"Is there a repository at the following location?\n/srv/repo\n",
+			},
+			class: "restic",
+		},
+		{
+			name: "access denied stderr",
+			err: restic.Error{
+				Command:  "snapshots",
+				ExitCode: 1,
+				Stderr: "Fatal: unable to open config file: Stat: Access Denied. (403)\n" +
+					"Is there a repository at the following location?\ns3:https://s3.example.com/bucket\n",
+			},
+			class: "restic",
+		},
+		{
+			name: "timeout stderr",
+			err: restic.Error{
+				Command:  "snapshots",
+				ExitCode: 1,
+				Stderr: "Fatal: unable to open config file: Stat: Get \"https://s3.example.com/bucket/config\": " +
+					"context deadline exceeded (Client.Timeout exceeded while awaiting headers)\n" +
+					"Is there a repository at the following location?\ns3:https://s3.example.com/bucket\n",
+			},
+			class: "restic",
+		},
+		{
+			name: "wrong password stderr",
+			err: restic.Error{
+				Command:  "snapshots",
+				ExitCode: 1,
+				Stderr:   "Fatal: wrong password or no key found\n",
+			},
+			expected: restic.ErrWrongPassword,
+			class:    "wrong_password",
+		},
+		{
+			name: "repository locked stderr",
+			err: restic.Error{
+				Command:  "prune",
+				ExitCode: 1,
+				Stderr: "unable to create lock in backend: repository is already locked by PID 42 " +
+					"on host by user (UID 0, GID 0)\n",
+			},
+			expected: restic.ErrRepoLocked,
+			class:    "repo_locked",
+		},
+		{
+			name: "backend unreachable stderr",
+			err: restic.Error{
+				Command:  "snapshots",
+				ExitCode: 1,
+				Stderr: "Fatal: unable to open config file: Stat: Get \"https://s3.example.com/bucket/config\": " +
+					"dial tcp: lookup s3.example.com: no such host\n" +
+					"Is there a repository at the following location?\n" +
+					"s3:https://s3.example.com/bucket\n",
+			},
+			expected: restic.ErrBackendUnreachable,
+			class:    "backend_unreachable",
+		},
+		{
+			name:     "interrupted stderr",
+			err:      restic.Error{Command: "backup", ExitCode: 1, Stderr: "signal interrupt received, cleaning up\n"},
+			expected: restic.ErrInterrupted,
+			class:    "interrupted",
+		},
+		{
+			name:     "wrapped error",
+			err:      fmt.Errorf("wrapped: %w", restic.Error{Command: "backup", ExitCode: 3}),
+			expected: restic.ErrIncompleteBackup,
+			class:    "incomplete_backup",
+		},
+		{
+			name:  "canceled",
+			err:   fmt.Errorf("wrapped: %w", context.Canceled),
+			class: "canceled",
+		},
+		{
+			name:  "other error",
+			err:   errors.New("other error"),
+			class: "other",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			for _, s := range sentinels {
+				if s == tt.expected {
+					assert.ErrorIs(t, tt.err, s)
+					continue
+				}
+				assert.NotErrorIs(t, tt.err, s)
+			}
+			assert.Equal(t, tt.class, restic.ErrorClass(tt.err))
+		})
+	}
+
+	assert.Equal(t, "", restic.ErrorClass(nil))
+}
+
+func TestError_Error(t *testing.T) {
+	err := restic.Error{Command: "backup", ExitCode: 3}
+	assert.EqualError(t, err, "restic backup: exit code: 3: incomplete backup")
+
+	err = restic.Error{Command: "backup", ExitCode: 1}
+	assert.EqualError(t, err, "restic backup: exit code: 1")
+}
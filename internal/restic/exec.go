@@ -1,10 +1,13 @@
 package restic
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"os/exec"
-	"strings"
+	"time"
 )
 
 // CmdRunner defines the Run method which allows to run an external command.
@@ -21,24 +24,94 @@ type CmdRunner interface {
 
 type osRunner struct{}
 
+// Run runs cmd. If cmd exits with a non-zero exit code an Error containing
+// the exit code is returned. The Error does not contain restic's stderr, as
+// the caller is responsible for processing cmd.Stderr.
 func (r *osRunner) Run(cmd *exec.Cmd) error {
-	var (
-		exitErr *exec.ExitError
-		stderr  strings.Builder
-	)
-
-	cmd.Stderr = &stderr
+	var exitErr *exec.ExitError
 
 	err := cmd.Run()
 	if errors.As(err, &exitErr) {
 		return Error{
 			ExitCode: exitErr.ExitCode(),
-			Stderr:   stderr.String(),
 		}
 	}
 	return err
 }
 
+// runRestic calls restic using the runner configured in opts. The first
+// element of args is expected to be the restic command. It is recorded in
+// any Error returned by the runner.
+func runRestic(ctx context.Context, opts options, args ...string) error {
+	return runResticOutput(ctx, opts, nil, args...)
+}
+
+// runResticOutput works like runRestic but additionally writes restic's
+// standard output to stdout.
+//
+// The outcome of each invocation is logged using the logger carried by ctx.
+// Restic's stdout and stderr are logged line by line while restic is
+// running. Lines written to stdout are logged at debug level if stdout is
+// not nil, as the caller processes them, and at info level otherwise. Lines
+// written to stderr are logged at warn level. At most maxStderrSize bytes
+// of stderr are kept for the returned Error.
+//
+// If ctx is canceled while restic is running, restic and all its child
+// processes receive SIGINT. They are killed if they do not exit within the
+// grace period configured in opts. See termination for details.
+func runResticOutput(ctx context.Context, opts options, stdout io.Writer, args ...string) error {
+	log := logger(ctx).With("command", args[0])
+
+	stdoutLevel := slog.LevelInfo
+	if stdout != nil {
+		stdoutLevel = slog.LevelDebug
+	}
+	stdoutLog := newLineLogger(log, stdoutLevel, "stdout")
+	stderrLog := newLineLogger(log, slog.LevelWarn, "stderr")
+	stderr := &tailBuffer{max: maxStderrSize}
+
+	cmd := exec.CommandContext(ctx, opts.Restic, args...)
+	term := newTermination(ctx, cmd, log, "restic", opts.KillGracePeriod)
+	cmd.Env = joinEnv(opts.Env)
+	cmd.Stdout = stdoutLog
+	if stdout != nil {
+		cmd.Stdout = io.MultiWriter(stdout, stdoutLog)
+	}
+	cmd.Stderr = io.MultiWriter(stderr, stderrLog)
+
+	setPhase(ctx, "restic "+args[0])
+	log.Debug("Running restic")
+	start := time.Now()
+	err := term.done(opts.Runner.Run(cmd))
+	duration := time.Since(start)
+	stdoutLog.Flush()
+	stderrLog.Flush()
+	if err == nil {
+		log.Debug("Restic completed", "duration", duration)
+		return nil
+	}
+
+	if err == ctx.Err() || errors.Is(err, ErrKilled) {
+		log.Warn("Restic canceled", "duration", duration)
+		return err
+	}
+	if rErr, ok := asError(err); ok {
+		rErr.Command = args[0]
+		if rErr.Stderr == "" {
+			rErr.Stderr = stderr.String()
+		}
+		log.Warn(
+			"Restic failed",
+			"duration", duration,
+			"exit_code", rErr.ExitCode,
+			"error_class", ErrorClass(rErr),
+		)
+		return rErr
+	}
+	log.Warn("Restic failed", "duration", duration, "error", err)
+	return fmt.Errorf("restic %s: %v", args[0], err)
+}
+
 func joinEnv(env map[string]string) []string {
 	res := make([]string, 0, len(env))
 	for k, v := range env {
@@ -0,0 +1,38 @@
+package restic
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunResticOutput_Interrupt(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var opts options
+	opts.apply([]Option{WithBinary("/bin/sh")})
+
+	// Interrupt the shell only once it installed its trap.
+	pr, pw := io.Pipe()
+	go func() {
+		sc := bufio.NewScanner(pr)
+		for sc.Scan() {
+			if sc.Text() == "ready" {
+				cancel()
+			}
+		}
+	}()
+
+	start := time.Now()
+	// The shell itself plays restic, which exits with code 130 on SIGINT.
+	script := "trap 'exit 130' INT; echo ready; sleep 10 >/dev/null 2>&1 & wait"
+	err := runResticOutput(ctx, opts, pw, "-c", script)
+	_ = pw.Close()
+	assert.ErrorIs(t, err, ErrInterrupted)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
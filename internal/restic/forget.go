@@ -0,0 +1,88 @@
+package restic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// ForgetPolicy defines which snapshots are kept when calling restic forget.
+//
+// The individual fields correspond to the --keep-* flags of restic forget. A
+// zero value for any of the fields means the respective flag is not passed
+// to restic. See the restic documentation
+// (https://restic.readthedocs.io/en/stable/060_forget.html#removing-snapshots-according-to-a-policy)
+// for details.
+type ForgetPolicy struct {
+	KeepLast    int      `yaml:"keep_last"`
+	KeepHourly  int      `yaml:"keep_hourly"`
+	KeepDaily   int      `yaml:"keep_daily"`
+	KeepWeekly  int      `yaml:"keep_weekly"`
+	KeepMonthly int      `yaml:"keep_monthly"`
+	KeepYearly  int      `yaml:"keep_yearly"`
+	KeepWithin  string   `yaml:"keep_within"`
+	KeepTags    []string `yaml:"keep_tags"`
+}
+
+// IsZero returns true if p does not keep any snapshots.
+//
+// Calling restic forget with an empty policy is pointless, as restic does
+// not remove any snapshots in this case.
+func (p ForgetPolicy) IsZero() bool {
+	return p.KeepLast == 0 &&
+		p.KeepHourly == 0 &&
+		p.KeepDaily == 0 &&
+		p.KeepWeekly == 0 &&
+		p.KeepMonthly == 0 &&
+		p.KeepYearly == 0 &&
+		p.KeepWithin == "" &&
+		len(p.KeepTags) == 0
+}
+
+func (p ForgetPolicy) args() []string {
+	var args []string
+
+	for _, kv := range []struct {
+		flag  string
+		value int
+	}{
+		{"--keep-last", p.KeepLast},
+		{"--keep-hourly", p.KeepHourly},
+		{"--keep-daily", p.KeepDaily},
+		{"--keep-weekly", p.KeepWeekly},
+		{"--keep-monthly", p.KeepMonthly},
+		{"--keep-yearly", p.KeepYearly},
+	} {
+		if kv.value > 0 {
+			args = append(args, kv.flag, strconv.Itoa(kv.value))
+		}
+	}
+	if p.KeepWithin != "" {
+		args = append(args, "--keep-within", p.KeepWithin)
+	}
+	for _, tag := range p.KeepTags {
+		args = append(args, "--keep-tag", tag)
+	}
+	return args
+}
+
+// Forget calls restic forget to remove snapshots from the repository.
+//
+// The snapshots to keep are selected using the ForgetPolicy passed using
+// WithForgetPolicy. Forget returns an error if no policy was passed. Forget
+// only removes the snapshots, it does not remove the data referenced by them.
+// Use Prune for this.
+func Forget(ctx context.Context, os ...Option) error {
+	var opts options
+
+	if err := opts.Apply(os); err != nil {
+		return fmt.Errorf("forget options: %v", err)
+	}
+	if opts.ForgetPolicy.IsZero() {
+		return errors.New("forget options: empty forget policy")
+	}
+
+	args := append([]string{"forget"}, opts.ForgetPolicy.args()...)
+	return runRestic(ctx, opts, args...)
+}
@@ -0,0 +1,105 @@
+package restic_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fhofherr/rsched/internal/restic"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForget(t *testing.T) {
+	tests := []restic.TestCase{
+		{
+			Name:     "empty policy",
+			Repo:     "/path/to/repository",
+			Password: "super secret",
+			Perform: func(t *testing.T, tt *restic.TestCase) {
+				tt.Options = append(tt.Options, restic.WithRepository(tt.Repo), restic.WithPassword(tt.Password))
+				err := restic.Forget(context.Background(), tt.Options...)
+				assert.EqualError(t, err, "forget options: empty forget policy")
+			},
+		},
+		{
+			Name:     "full policy",
+			Repo:     "/path/to/repository",
+			Password: "super secret",
+			Invocations: func(t *testing.T, tt *restic.TestCase) []restic.ExpectedInvocation {
+				return []restic.ExpectedInvocation{
+					{
+						Args: []string{
+							"restic", "forget",
+							"--keep-last", "1",
+							"--keep-hourly", "2",
+							"--keep-daily", "3",
+							"--keep-weekly", "4",
+							"--keep-monthly", "5",
+							"--keep-yearly", "6",
+							"--keep-within", "1y2m3d",
+							"--keep-tag", "important",
+							"--keep-tag", "keep,forever",
+						},
+						Env: map[string]string{
+							"RESTIC_REPOSITORY": tt.Repo,
+							"RESTIC_PASSWORD":   tt.Password,
+						},
+					},
+				}
+			},
+			Perform: func(t *testing.T, tt *restic.TestCase) {
+				tt.Options = append(
+					tt.Options,
+					restic.WithRepository(tt.Repo),
+					restic.WithPassword(tt.Password),
+					restic.WithForgetPolicy(restic.ForgetPolicy{
+						KeepLast:    1,
+						KeepHourly:  2,
+						KeepDaily:   3,
+						KeepWeekly:  4,
+						KeepMonthly: 5,
+						KeepYearly:  6,
+						KeepWithin:  "1y2m3d",
+						KeepTags:    []string{"important", "keep,forever"},
+					}),
+				)
+				err := restic.Forget(context.Background(), tt.Options...)
+				assert.NoError(t, err)
+			},
+		},
+		{
+			Name:     "error during forget",
+			Repo:     "/path/to/repository",
+			Password: "super secret",
+			Invocations: func(t *testing.T, tt *restic.TestCase) []restic.ExpectedInvocation {
+				return []restic.ExpectedInvocation{
+					{
+						Args: []string{"restic", "forget", "--keep-daily", "7"},
+						Env: map[string]string{
+							"RESTIC_REPOSITORY": tt.Repo,
+							"RESTIC_PASSWORD":   tt.Password,
+						},
+						Code: 1,
+					},
+				}
+			},
+			Perform: func(t *testing.T, tt *restic.TestCase) {
+				tt.Options = append(
+					tt.Options,
+					restic.WithRepository(tt.Repo),
+					restic.WithPassword(tt.Password),
+					restic.WithForgetPolicy(restic.ForgetPolicy{KeepDaily: 7}),
+				)
+				err := restic.Forget(context.Background(), tt.Options...)
+				assert.ErrorIs(t, err, restic.Error{
+					Command:  "forget",
+					ExitCode: 1,
+				})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.Name, tt.Run)
+	}
+}
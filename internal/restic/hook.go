@@ -0,0 +1,230 @@
+package restic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"time"
+)
+
+// ErrHookFailed is returned by Backup if a hook failed and its failure
+// policy is HookAbort.
+var ErrHookFailed = errors.New("hook failed")
+
+// DefaultHookTimeout is the timeout of hooks which do not define their own
+// timeout.
+const DefaultHookTimeout = 5 * time.Minute
+
+// Names of the environment variables passed to hooks in addition to the
+// restic environment.
+const (
+	EnvHookJobName    = "RSCHED_JOB_NAME"
+	EnvHookStage      = "RSCHED_HOOK_STAGE"
+	EnvHookSnapshotID = "RSCHED_SNAPSHOT_ID"
+	EnvHookErrorClass = "RSCHED_ERROR_CLASS"
+	EnvHookError      = "RSCHED_ERROR"
+)
+
+// Stages at which hooks are executed.
+const (
+	HookStageBefore       = "before"
+	HookStageAfterSuccess = "after-success"
+	HookStageAfterFailure = "after-failure"
+	HookStageAlways       = "always"
+)
+
+// HookFailurePolicy defines how Backup reacts to a failing hook.
+type HookFailurePolicy int
+
+// Supported values of HookFailurePolicy.
+const (
+	// HookAbort aborts the backup if a before hook fails. If any other hook
+	// fails the backup is considered failed. The remaining hooks of the
+	// same stage are skipped.
+	HookAbort HookFailurePolicy = iota
+
+	// HookContinue logs the failure of a hook and continues as if the hook
+	// succeeded.
+	HookContinue
+)
+
+var hookFailurePolicyNames = map[HookFailurePolicy]string{
+	HookAbort:    "abort",
+	HookContinue: "continue",
+}
+
+// String returns the name of p.
+func (p HookFailurePolicy) String() string {
+	return hookFailurePolicyNames[p]
+}
+
+// Set sets p to the HookFailurePolicy called name. This allows to use p as
+// a flag.Value.
+func (p *HookFailurePolicy) Set(name string) error {
+	for k, n := range hookFailurePolicyNames {
+		if n == name {
+			*p = k
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown hook failure policy: %q", name)
+}
+
+// UnmarshalText sets p to the HookFailurePolicy called text.
+func (p *HookFailurePolicy) UnmarshalText(text []byte) error {
+	return p.Set(string(text))
+}
+
+// Hook is a command executed before or after a backup.
+//
+// The command is executed using /bin/sh -c. If it does not complete within
+// Timeout it is interrupted together with all its child processes like
+// restic, see termination. If Timeout is zero DefaultHookTimeout is used.
+type Hook struct {
+	Command   string            `yaml:"command"`
+	Timeout   time.Duration     `yaml:"timeout"`
+	OnFailure HookFailurePolicy `yaml:"on_failure"`
+}
+
+// Hooks contains the hooks executed by Backup.
+//
+// Before hooks are executed before the backup is started. Depending on the
+// outcome of the backup either the AfterSuccess or the AfterFailure hooks
+// are executed once the backup is done. The Always hooks are executed last,
+// regardless of the outcome of the backup or any other hook. Hooks of the
+// same stage are executed in order.
+//
+// If a before hook aborts the backup, the AfterFailure and Always hooks are
+// still executed. This allows to resume applications stopped by an earlier
+// before hook.
+type Hooks struct {
+	Before       []Hook `yaml:"before"`
+	AfterSuccess []Hook `yaml:"after_success"`
+	AfterFailure []Hook `yaml:"after_failure"`
+	Always       []Hook `yaml:"always"`
+}
+
+// Validate checks if all hooks in hs have a command.
+func (hs Hooks) Validate() error {
+	for stage, hooks := range map[string][]Hook{
+		HookStageBefore:       hs.Before,
+		HookStageAfterSuccess: hs.AfterSuccess,
+		HookStageAfterFailure: hs.AfterFailure,
+		HookStageAlways:       hs.Always,
+	} {
+		for i, h := range hooks {
+			if h.Command == "" {
+				return fmt.Errorf("%s hook %d: command missing", stage, i)
+			}
+		}
+	}
+	return nil
+}
+
+// hookEnv contains the information about a backup passed to its hooks.
+type hookEnv struct {
+	JobName    string
+	SnapshotID string
+	Err        error
+}
+
+// runBeforeHooks executes the before hooks in opts.
+func runBeforeHooks(ctx context.Context, opts options) error {
+	return runHooks(ctx, opts, HookStageBefore, opts.Hooks.Before, hookEnv{JobName: opts.JobName})
+}
+
+// runAfterHooks executes the after hooks in opts for a backup which
+// completed with err.
+//
+// The after hooks are executed even if ctx is already canceled, e.g.
+// because rsched is shutting down. They are still subject to their timeout.
+func runAfterHooks(ctx context.Context, opts options, snapshotID string, err error) error {
+	var errs []error
+
+	ctx = context.WithoutCancel(ctx)
+	env := hookEnv{JobName: opts.JobName, SnapshotID: snapshotID, Err: err}
+	if err == nil {
+		errs = append(errs, runHooks(ctx, opts, HookStageAfterSuccess, opts.Hooks.AfterSuccess, env))
+	} else {
+		errs = append(errs, runHooks(ctx, opts, HookStageAfterFailure, opts.Hooks.AfterFailure, env))
+	}
+	errs = append(errs, runHooks(ctx, opts, HookStageAlways, opts.Hooks.Always, env))
+	return errors.Join(errs...)
+}
+
+// runHooks executes hooks in order. It stops at the first hook failing with
+// failure policy HookAbort and returns an error wrapping ErrHookFailed.
+func runHooks(ctx context.Context, opts options, stage string, hooks []Hook, env hookEnv) error {
+	for i, h := range hooks {
+		log := logger(ctx).With("hook_stage", stage, "hook", i)
+
+		err := runHook(ctx, opts, log, h, stage, env)
+		if err == nil {
+			continue
+		}
+		if h.OnFailure == HookContinue {
+			log.Warn("Hook failed, continuing", "error", err)
+			continue
+		}
+		log.Error("Hook failed", "error", err)
+		return fmt.Errorf("%s hook %d: %w: %v", stage, i, ErrHookFailed, err)
+	}
+	return nil
+}
+
+func runHook(ctx context.Context, opts options, log *slog.Logger, h Hook, stage string, env hookEnv) error {
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = DefaultHookTimeout
+	}
+	ctx, cancel := context.WithTimeoutCause(ctx, timeout, fmt.Errorf("timed out after %s", timeout))
+	defer cancel()
+
+	vars := map[string]string{
+		EnvHookJobName:    env.JobName,
+		EnvHookStage:      stage,
+		EnvHookSnapshotID: env.SnapshotID,
+		EnvHookErrorClass: ErrorClass(env.Err),
+		EnvHookError:      "",
+	}
+	if env.Err != nil {
+		vars[EnvHookError] = env.Err.Error()
+	}
+	hookEnv := make(map[string]string, len(opts.Env)+len(vars))
+	for k, v := range opts.Env {
+		hookEnv[k] = v
+	}
+	for k, v := range vars {
+		hookEnv[k] = v
+	}
+
+	stdoutLog := newLineLogger(log, slog.LevelInfo, "stdout")
+	stderrLog := newLineLogger(log, slog.LevelWarn, "stderr")
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", h.Command)
+	term := newTermination(ctx, cmd, log, "hook", opts.KillGracePeriod)
+	cmd.Env = joinEnv(hookEnv)
+	cmd.Stdout = stdoutLog
+	cmd.Stderr = stderrLog
+
+	setPhase(ctx, "hook "+stage)
+	log.Info("Running hook")
+	start := time.Now()
+	err := term.done(opts.Runner.Run(cmd))
+	stdoutLog.Flush()
+	stderrLog.Flush()
+	if ctx.Err() != nil {
+		// Either the hook timed out, or ctx was canceled for another
+		// reason, e.g. the timeout of the job or a shutdown.
+		return context.Cause(ctx)
+	}
+	if err != nil {
+		if rErr, ok := asError(err); ok {
+			return fmt.Errorf("exit code: %d", rErr.ExitCode)
+		}
+		return err
+	}
+	log.Info("Hook completed", "duration", time.Since(start))
+	return nil
+}
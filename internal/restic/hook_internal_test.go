@@ -0,0 +1,40 @@
+//go:build linux
+
+package restic
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunHook_Timeout(t *testing.T) {
+	var opts options
+	opts.apply([]Option{WithKillGracePeriod(100 * time.Millisecond)})
+
+	// The hook's child process keeps stdout open. Killing only the shell
+	// would leave runHook waiting for the child.
+	h := Hook{Command: "sleep 10; echo done", Timeout: 100 * time.Millisecond}
+	start := time.Now()
+	err := runHook(context.Background(), opts, slog.Default(), h, HookStageBefore, hookEnv{})
+	assert.ErrorContains(t, err, "timed out after 100ms")
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestRunHook_ParentTimeout(t *testing.T) {
+	var opts options
+	opts.apply([]Option{WithKillGracePeriod(100 * time.Millisecond)})
+
+	cause := errors.New("job timed out")
+	ctx, cancel := context.WithTimeoutCause(context.Background(), 100*time.Millisecond, cause)
+	defer cancel()
+
+	h := Hook{Command: "sleep 10; echo done", Timeout: time.Minute}
+	err := runHook(ctx, opts, slog.Default(), h, HookStageBefore, hookEnv{})
+	assert.ErrorIs(t, err, cause)
+	assert.NotContains(t, err.Error(), "timed out after")
+}
@@ -0,0 +1,249 @@
+package restic_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fhofherr/rsched/internal/restic"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackup_Hooks(t *testing.T) {
+	env := func(tt *restic.TestCase, extra map[string]string) map[string]string {
+		res := map[string]string{
+			"RESTIC_REPOSITORY":  tt.Repo,
+			"RESTIC_PASSWORD":    tt.Password,
+			"RSCHED_JOB_NAME":    "test",
+			"RSCHED_SNAPSHOT_ID": "",
+			"RSCHED_ERROR_CLASS": "",
+			"RSCHED_ERROR":       "",
+		}
+		for k, v := range extra {
+			res[k] = v
+		}
+		return res
+	}
+	resticEnv := func(tt *restic.TestCase) map[string]string {
+		return map[string]string{
+			"RESTIC_REPOSITORY": tt.Repo,
+			"RESTIC_PASSWORD":   tt.Password,
+		}
+	}
+	hook := func(command string) []string {
+		return []string{"/bin/sh", "-c", command}
+	}
+
+	tests := []restic.TestCase{
+		{
+			Name:        "successful backup",
+			Repo:        "/path/to/repository",
+			Password:    "super secret",
+			BackupPaths: []string{"/some/path"},
+			Options: []restic.Option{
+				restic.WithJobName("test"),
+				restic.WithInitPolicy(restic.InitNever),
+				restic.WithHooks(restic.Hooks{
+					Before:       []restic.Hook{{Command: "stop app"}},
+					AfterSuccess: []restic.Hook{{Command: "report success"}},
+					AfterFailure: []restic.Hook{{Command: "report failure"}},
+					Always:       []restic.Hook{{Command: "start app"}},
+				}),
+			},
+			Invocations: func(t *testing.T, tt *restic.TestCase) []restic.ExpectedInvocation {
+				return []restic.ExpectedInvocation{
+					{
+						Args: hook("stop app"),
+						Env:  env(tt, map[string]string{"RSCHED_HOOK_STAGE": "before"}),
+					},
+					{
+						Args:   []string{"restic", "backup", "--json", tt.BackupPaths[0]},
+						Env:    resticEnv(tt),
+						Stdout: `{"message_type":"summary","snapshot_id":"abcdef"}`,
+					},
+					{
+						Args: hook("report success"),
+						Env: env(tt, map[string]string{
+							"RSCHED_HOOK_STAGE":  "after-success",
+							"RSCHED_SNAPSHOT_ID": "abcdef",
+						}),
+					},
+					{
+						Args: hook("start app"),
+						Env: env(tt, map[string]string{
+							"RSCHED_HOOK_STAGE":  "always",
+							"RSCHED_SNAPSHOT_ID": "abcdef",
+						}),
+					},
+				}
+			},
+			Perform: func(t *testing.T, tt *restic.TestCase) {
+				tt.Options = append(tt.Options, restic.WithRepository(tt.Repo), restic.WithPassword(tt.Password))
+				_, err := restic.Backup(context.Background(), tt.BackupPaths, tt.Options...)
+				assert.NoError(t, err)
+			},
+		},
+		{
+			Name:        "failed backup",
+			Repo:        "/path/to/repository",
+			Password:    "super secret",
+			BackupPaths: []string{"/some/path"},
+			Options: []restic.Option{
+				restic.WithJobName("test"),
+				restic.WithInitPolicy(restic.InitNever),
+				restic.WithHooks(restic.Hooks{
+					AfterSuccess: []restic.Hook{{Command: "report success"}},
+					AfterFailure: []restic.Hook{{Command: "report failure"}},
+					Always:       []restic.Hook{{Command: "start app"}},
+				}),
+			},
+			Invocations: func(t *testing.T, tt *restic.TestCase) []restic.ExpectedInvocation {
+				return []restic.ExpectedInvocation{
+					{
+						Args: []string{"restic", "backup", "--json", tt.BackupPaths[0]},
+						Env:  resticEnv(tt),
+						Code: 12,
+					},
+					{
+						Args: hook("report failure"),
+						Env: env(tt, map[string]string{
+							"RSCHED_HOOK_STAGE":  "after-failure",
+							"RSCHED_ERROR_CLASS": "wrong_password",
+							"RSCHED_ERROR":       "restic backup: exit code: 12: wrong password",
+						}),
+					},
+					{
+						Args: hook("start app"),
+						Env: env(tt, map[string]string{
+							"RSCHED_HOOK_STAGE":  "always",
+							"RSCHED_ERROR_CLASS": "wrong_password",
+							"RSCHED_ERROR":       "restic backup: exit code: 12: wrong password",
+						}),
+					},
+				}
+			},
+			Perform: func(t *testing.T, tt *restic.TestCase) {
+				tt.Options = append(tt.Options, restic.WithRepository(tt.Repo), restic.WithPassword(tt.Password))
+				_, err := restic.Backup(context.Background(), tt.BackupPaths, tt.Options...)
+				assert.ErrorIs(t, err, restic.ErrWrongPassword)
+				assert.Equal(t, "wrong_password", restic.ErrorClass(err))
+			},
+		},
+		{
+			Name:        "before hook aborts backup",
+			Repo:        "/path/to/repository",
+			Password:    "super secret",
+			BackupPaths: []string{"/some/path"},
+			Options: []restic.Option{
+				restic.WithJobName("test"),
+				restic.WithHooks(restic.Hooks{
+					Before: []restic.Hook{
+						{Command: "stop app"},
+						{Command: "never called"},
+					},
+					AfterFailure: []restic.Hook{{Command: "report failure"}},
+				}),
+			},
+			Invocations: func(t *testing.T, tt *restic.TestCase) []restic.ExpectedInvocation {
+				return []restic.ExpectedInvocation{
+					{
+						Args: hook("stop app"),
+						Env:  env(tt, map[string]string{"RSCHED_HOOK_STAGE": "before"}),
+						Code: 1,
+					},
+					{
+						Args: hook("report failure"),
+						Env: env(tt, map[string]string{
+							"RSCHED_HOOK_STAGE":  "after-failure",
+							"RSCHED_ERROR_CLASS": "hook_failed",
+							"RSCHED_ERROR":       "before hook 0: hook failed: exit code: 1",
+						}),
+					},
+				}
+			},
+			Perform: func(t *testing.T, tt *restic.TestCase) {
+				tt.Options = append(tt.Options, restic.WithRepository(tt.Repo), restic.WithPassword(tt.Password))
+				_, err := restic.Backup(context.Background(), tt.BackupPaths, tt.Options...)
+				assert.ErrorIs(t, err, restic.ErrHookFailed)
+			},
+		},
+		{
+			Name:        "failing hooks with continue policy",
+			Repo:        "/path/to/repository",
+			Password:    "super secret",
+			BackupPaths: []string{"/some/path"},
+			Options: []restic.Option{
+				restic.WithJobName("test"),
+				restic.WithInitPolicy(restic.InitNever),
+				restic.WithHooks(restic.Hooks{
+					Before: []restic.Hook{{Command: "stop app", OnFailure: restic.HookContinue}},
+					Always: []restic.Hook{{Command: "start app", OnFailure: restic.HookContinue}},
+				}),
+			},
+			Invocations: func(t *testing.T, tt *restic.TestCase) []restic.ExpectedInvocation {
+				return []restic.ExpectedInvocation{
+					{
+						Args: hook("stop app"),
+						Env:  env(tt, map[string]string{"RSCHED_HOOK_STAGE": "before"}),
+						Code: 1,
+					},
+					{
+						Args: []string{"restic", "backup", "--json", tt.BackupPaths[0]},
+						Env:  resticEnv(tt),
+					},
+					{
+						Args: hook("start app"),
+						Env:  env(tt, map[string]string{"RSCHED_HOOK_STAGE": "always"}),
+						Code: 1,
+					},
+				}
+			},
+			Perform: func(t *testing.T, tt *restic.TestCase) {
+				tt.Options = append(tt.Options, restic.WithRepository(tt.Repo), restic.WithPassword(tt.Password))
+				_, err := restic.Backup(context.Background(), tt.BackupPaths, tt.Options...)
+				assert.NoError(t, err)
+			},
+		},
+		{
+			Name:        "failing after hook fails backup",
+			Repo:        "/path/to/repository",
+			Password:    "super secret",
+			BackupPaths: []string{"/some/path"},
+			Options: []restic.Option{
+				restic.WithJobName("test"),
+				restic.WithInitPolicy(restic.InitNever),
+				restic.WithHooks(restic.Hooks{
+					Always: []restic.Hook{{Command: "start app"}},
+				}),
+			},
+			Invocations: func(t *testing.T, tt *restic.TestCase) []restic.ExpectedInvocation {
+				return []restic.ExpectedInvocation{
+					{
+						Args: []string{"restic", "backup", "--json", tt.BackupPaths[0]},
+						Env:  resticEnv(tt),
+					},
+					{
+						Args: hook("start app"),
+						Env:  env(tt, map[string]string{"RSCHED_HOOK_STAGE": "always"}),
+						Code: 1,
+					},
+				}
+			},
+			Perform: func(t *testing.T, tt *restic.TestCase) {
+				tt.Options = append(tt.Options, restic.WithRepository(tt.Repo), restic.WithPassword(tt.Password))
+				_, err := restic.Backup(context.Background(), tt.BackupPaths, tt.Options...)
+				assert.ErrorIs(t, err, restic.ErrHookFailed)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.Name, tt.Run)
+	}
+}
+
+func TestHooks_Validate(t *testing.T) {
+	assert.NoError(t, restic.Hooks{Before: []restic.Hook{{Command: "true"}}}.Validate())
+	assert.Error(t, restic.Hooks{Always: []restic.Hook{{Timeout: time.Second}}}.Validate())
+}
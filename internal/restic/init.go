@@ -0,0 +1,86 @@
+package restic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// InitPolicy defines if and when Backup initializes the restic repository.
+type InitPolicy int
+
+// Supported values of InitPolicy.
+const (
+	// InitIfMissing checks if the repository exists before each backup and
+	// initializes it if restic reports that it does not exist. Any other
+	// failure, e.g. a wrong password or an unreachable backend, aborts the
+	// backup without initializing the repository.
+	InitIfMissing InitPolicy = iota
+
+	// InitNever neither checks nor initializes the repository. The
+	// repository has to be initialized manually.
+	InitNever
+
+	// InitAlwaysCheck checks if the repository exists before each backup,
+	// but never initializes it. The backup is aborted if the repository
+	// does not exist.
+	InitAlwaysCheck
+)
+
+var initPolicyNames = map[InitPolicy]string{
+	InitIfMissing:   "if-missing",
+	InitNever:       "never",
+	InitAlwaysCheck: "always-check",
+}
+
+// String returns the name of p.
+func (p InitPolicy) String() string {
+	return initPolicyNames[p]
+}
+
+// Set sets p to the InitPolicy called name. This allows to use p as a
+// flag.Value.
+func (p *InitPolicy) Set(name string) error {
+	for k, n := range initPolicyNames {
+		if n == name {
+			*p = k
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown init policy: %q", name)
+}
+
+// UnmarshalText sets p to the InitPolicy called text.
+func (p *InitPolicy) UnmarshalText(text []byte) error {
+	return p.Set(string(text))
+}
+
+// prepareRepo checks and initializes the repository according to
+// opts.InitPolicy.
+//
+// The repository is only initialized if restic positively reports that it
+// does not exist.
+func prepareRepo(ctx context.Context, opts options) error {
+	log := logger(ctx).With("init_policy", opts.InitPolicy.String())
+	if opts.InitPolicy == InitNever {
+		log.Info("Not checking repository")
+		return nil
+	}
+
+	err := runRestic(ctx, opts, "snapshots")
+	if err == nil {
+		log.Info("Repository exists")
+		return nil
+	}
+	if !errors.Is(err, ErrRepoNotExist) {
+		log.Warn("Repository check failed, not initializing repository", "error_class", ErrorClass(err))
+		return fmt.Errorf("check repository: %w", err)
+	}
+	if opts.InitPolicy == InitAlwaysCheck {
+		log.Warn("Repository does not exist, not initializing repository")
+		return fmt.Errorf("check repository: %w", err)
+	}
+
+	log.Info("Repository does not exist, initializing repository")
+	return runRestic(ctx, opts, "init")
+}
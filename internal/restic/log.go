@@ -0,0 +1,38 @@
+package restic
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+)
+
+type loggerKey struct{}
+
+// withLogger returns a copy of ctx carrying l.
+func withLogger(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// logger returns the logger carried by ctx. If ctx does not carry a logger
+// slog.Default is returned.
+//
+// Scheduler passes a logger to each job which adds the name of the job and
+// the ID of the current run to each log entry.
+func logger(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
+
+// newRunID returns a random ID identifying a single run of a job.
+func newRunID() string {
+	var b [8]byte
+
+	if _, err := rand.Read(b[:]); err != nil {
+		// crypto/rand never fails on any of the systems we care about.
+		panic(err)
+	}
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,185 @@
+package restic_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fhofherr/rsched/internal/restic"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScheduler_Logging(t *testing.T) {
+	var buf bytes.Buffer
+
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	defer slog.SetDefault(defaultLogger)
+
+	runner := &restic.TestCmdRunner{
+		T: t,
+		Invocations: []restic.ExpectedInvocation{
+			{
+				Args: []string{"restic", "prune"},
+				Env: map[string]string{
+					"RESTIC_REPOSITORY": "/path/to/repository",
+					"RESTIC_PASSWORD":   "secret",
+				},
+				Code:   1,
+				Stderr: "Fatal: wrong password or no key found\n",
+			},
+		},
+	}
+	s := &restic.Scheduler{}
+	defer s.Shutdown()
+
+	err := s.SchedulePrune(
+		"@daily",
+		restic.WithJobName("test"),
+		restic.WithRepository("/path/to/repository"),
+		restic.WithPassword("secret"),
+		restic.WithCmdRunner(runner),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	buf.Reset()
+	restic.RunScheduledJobs(t, s)
+	runner.AssertComplete()
+
+	var (
+		runIDs  = make(map[interface{}]bool)
+		entries []map[string]interface{}
+	)
+	sc := bufio.NewScanner(&buf)
+	for sc.Scan() {
+		var entry map[string]interface{}
+
+		if !assert.NoError(t, json.Unmarshal(sc.Bytes(), &entry)) {
+			return
+		}
+		assert.Equal(t, "test", entry["job"])
+		assert.Equal(t, "prune", entry["kind"])
+		assert.NotEmpty(t, entry["run_id"])
+		runIDs[entry["run_id"]] = true
+		entries = append(entries, entry)
+	}
+	assert.Len(t, runIDs, 1, "All entries of a run must have the same run ID")
+
+	var stderr, failed, jobFailed bool
+	for _, e := range entries {
+		switch e["msg"] {
+		case "Fatal: wrong password or no key found":
+			stderr = true
+			assert.Equal(t, "prune", e["command"])
+			assert.Equal(t, "stderr", e["stream"])
+			assert.Equal(t, "WARN", e["level"])
+		case "Restic failed":
+			failed = true
+			assert.Equal(t, "prune", e["command"])
+			assert.Equal(t, "wrong_password", e["error_class"])
+			assert.Contains(t, e, "duration")
+		case "Job failed":
+			jobFailed = true
+			assert.Equal(t, "wrong_password", e["error_class"])
+			assert.Contains(t, e, "duration")
+		}
+	}
+	assert.True(t, stderr, "restic stderr not logged")
+	assert.True(t, failed, "restic failure not logged")
+	assert.True(t, jobFailed, "job failure not logged")
+}
+
+func TestScheduler_ShutdownTimeout(t *testing.T) {
+	var buf syncBuffer
+
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	defer slog.SetDefault(defaultLogger)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	runner := &restic.TestCmdRunner{
+		T: t,
+		Invocations: []restic.ExpectedInvocation{
+			{
+				Args: []string{"restic", "prune"},
+				Env: map[string]string{
+					"RESTIC_REPOSITORY": "/path/to/repository",
+					"RESTIC_PASSWORD":   "secret",
+				},
+				Effect: func(t *testing.T, cmd *exec.Cmd) {
+					close(started)
+					<-release
+				},
+			},
+		},
+	}
+	s := &restic.Scheduler{ShutdownTimeout: 10 * time.Millisecond}
+	err := s.SchedulePrune(
+		restic.ScheduleOnce,
+		restic.WithJobName("test"),
+		restic.WithRepository("/path/to/repository"),
+		restic.WithPassword("secret"),
+		restic.WithCmdRunner(runner),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- s.Run()
+	}()
+
+	<-started
+	s.Shutdown()
+	close(release)
+	assert.ErrorIs(t, <-runErr, restic.ErrShutdownTimeout)
+
+	var interrupting, timedOut bool
+	sc := bufio.NewScanner(strings.NewReader(buf.String()))
+	for sc.Scan() {
+		var entry map[string]interface{}
+
+		if !assert.NoError(t, json.Unmarshal(sc.Bytes(), &entry)) {
+			return
+		}
+		switch entry["msg"] {
+		case "Shutting down, interrupting running job":
+			interrupting = true
+		case "Shutdown timed out, killing running job":
+			timedOut = true
+		default:
+			continue
+		}
+		assert.Equal(t, "test", entry["job"])
+		assert.Equal(t, "prune", entry["kind"])
+		assert.Equal(t, "restic prune", entry["phase"])
+	}
+	assert.True(t, interrupting, "Interrupted job not logged")
+	assert.True(t, timedOut, "Shutdown timeout not logged")
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
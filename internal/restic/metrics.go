@@ -0,0 +1,173 @@
+package restic
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const metricsNamespace = "rsched"
+
+// Metrics contains the Prometheus metrics recorded by Scheduler.
+//
+// A nil *Metrics is valid and records nothing.
+type Metrics struct {
+	lastRunTimestamp *prometheus.GaugeVec
+	lastRunDuration  *prometheus.GaugeVec
+	lastRunSuccess   *prometheus.GaugeVec
+	nextRunTimestamp *prometheus.GaugeVec
+	plannedStart     *prometheus.GaugeVec
+	runs             *prometheus.CounterVec
+	failures         *prometheus.CounterVec
+	attempts         *prometheus.CounterVec
+	skippedRuns      *prometheus.CounterVec
+
+	backupDataAdded    *prometheus.GaugeVec
+	backupFilesNew     *prometheus.GaugeVec
+	backupFilesChanged *prometheus.GaugeVec
+}
+
+// NewMetrics creates new Metrics and registers them with reg.
+func NewMetrics(reg prometheus.Registerer) *Metrics {
+	jobLabels := []string{"job", "kind"}
+	m := &Metrics{
+		lastRunTimestamp: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "job_last_run_timestamp_seconds",
+			Help:      "Time the last run of the job was completed as unix timestamp.",
+		}, jobLabels),
+		lastRunDuration: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "job_last_run_duration_seconds",
+			Help:      "Duration of the last run of the job.",
+		}, jobLabels),
+		lastRunSuccess: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "job_last_run_success",
+			Help:      "Whether the last run of the job was successful (1) or not (0).",
+		}, jobLabels),
+		nextRunTimestamp: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "job_next_run_timestamp_seconds",
+			Help:      "Time the job is scheduled to run next as unix timestamp.",
+		}, jobLabels),
+		plannedStart: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "job_planned_start_timestamp_seconds",
+			Help:      "Planned start of the last run of the job after its start delay as unix timestamp.",
+		}, jobLabels),
+		runs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "job_runs_total",
+			Help:      "Total number of runs of the job.",
+		}, jobLabels),
+		failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "job_failures_total",
+			Help:      "Total number of failed runs of the job by error class.",
+		}, append(jobLabels, "error_class")),
+		attempts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "job_attempts_total",
+			Help:      "Total number of attempts of the job, including retries, by error class.",
+		}, append(jobLabels, "error_class")),
+		skippedRuns: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "job_skipped_runs_total",
+			Help:      "Total number of skipped runs of the job by reason.",
+		}, append(jobLabels, "reason")),
+		backupDataAdded: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "backup_last_data_added_bytes",
+			Help:      "Bytes added to the repository by the last backup of the job.",
+		}, []string{"job"}),
+		backupFilesNew: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "backup_last_files_new",
+			Help:      "Number of new files in the last backup of the job.",
+		}, []string{"job"}),
+		backupFilesChanged: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "backup_last_files_changed",
+			Help:      "Number of changed files in the last backup of the job.",
+		}, []string{"job"}),
+	}
+	reg.MustRegister(
+		m.lastRunTimestamp,
+		m.lastRunDuration,
+		m.lastRunSuccess,
+		m.nextRunTimestamp,
+		m.plannedStart,
+		m.runs,
+		m.failures,
+		m.attempts,
+		m.skippedRuns,
+		m.backupDataAdded,
+		m.backupFilesNew,
+		m.backupFilesChanged,
+	)
+	return m
+}
+
+// observeRun records a completed run of the job described by info.
+func (m *Metrics) observeRun(info jobInfo, start time.Time, duration time.Duration, err error) {
+	if m == nil {
+		return
+	}
+
+	m.lastRunTimestamp.WithLabelValues(info.Name, info.Kind).Set(float64(start.Add(duration).Unix()))
+	m.lastRunDuration.WithLabelValues(info.Name, info.Kind).Set(duration.Seconds())
+	m.runs.WithLabelValues(info.Name, info.Kind).Inc()
+	if err != nil {
+		m.lastRunSuccess.WithLabelValues(info.Name, info.Kind).Set(0)
+		m.failures.WithLabelValues(info.Name, info.Kind, ErrorClass(err)).Inc()
+		return
+	}
+	m.lastRunSuccess.WithLabelValues(info.Name, info.Kind).Set(1)
+}
+
+// observeAttempt records a single attempt of a run of the job described by
+// info.
+func (m *Metrics) observeAttempt(info jobInfo, err error) {
+	if m == nil {
+		return
+	}
+	m.attempts.WithLabelValues(info.Name, info.Kind, ErrorClass(err)).Inc()
+}
+
+// observeSkippedRun records a skipped run of the job described by info.
+// reason is one of "overlap", "window", or "condition".
+func (m *Metrics) observeSkippedRun(info jobInfo, reason string) {
+	if m == nil {
+		return
+	}
+	m.skippedRuns.WithLabelValues(info.Name, info.Kind, reason).Inc()
+}
+
+// observeNextRun records the time the job described by info runs next.
+func (m *Metrics) observeNextRun(info jobInfo, next time.Time) {
+	if m == nil {
+		return
+	}
+	m.nextRunTimestamp.WithLabelValues(info.Name, info.Kind).Set(float64(next.Unix()))
+}
+
+// observePlannedStart records the time the current run of the job described
+// by info starts after its start delay.
+func (m *Metrics) observePlannedStart(info jobInfo, start time.Time) {
+	if m == nil {
+		return
+	}
+	m.plannedStart.WithLabelValues(info.Name, info.Kind).Set(float64(start.Unix()))
+}
+
+// observeBackup records the summary of a backup created by the job described
+// by info.
+func (m *Metrics) observeBackup(info jobInfo, summary BackupSummary) {
+	if m == nil {
+		return
+	}
+	m.backupDataAdded.WithLabelValues(info.Name).Set(float64(summary.DataAdded))
+	m.backupFilesNew.WithLabelValues(info.Name).Set(float64(summary.FilesNew))
+	m.backupFilesChanged.WithLabelValues(info.Name).Set(float64(summary.FilesChanged))
+}
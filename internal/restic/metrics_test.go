@@ -0,0 +1,83 @@
+package restic_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/fhofherr/rsched/internal/restic"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	results := []error{nil, restic.Error{Command: "backup", ExitCode: 12}}
+	s := &restic.Scheduler{
+		BackupFunc: func(ctx context.Context, paths []string, os ...restic.Option) (restic.BackupSummary, error) {
+			err := results[0]
+			results = results[1:]
+			if err != nil {
+				return restic.BackupSummary{}, err
+			}
+			return restic.BackupSummary{SnapshotID: "abcdef", FilesNew: 1, FilesChanged: 2, DataAdded: 3}, nil
+		},
+		Metrics: restic.NewMetrics(reg),
+	}
+	defer s.Shutdown()
+
+	err := s.ScheduleBackup("@hourly", []string{"/some/path"}, restic.WithJobName("test"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	restic.RunScheduledJobs(t, s)
+	restic.RunScheduledJobs(t, s)
+
+	expected := `
+# HELP rsched_backup_last_data_added_bytes Bytes added to the repository by the last backup of the job.
+# TYPE rsched_backup_last_data_added_bytes gauge
+rsched_backup_last_data_added_bytes{job="test"} 3
+# HELP rsched_backup_last_files_changed Number of changed files in the last backup of the job.
+# TYPE rsched_backup_last_files_changed gauge
+rsched_backup_last_files_changed{job="test"} 2
+# HELP rsched_backup_last_files_new Number of new files in the last backup of the job.
+# TYPE rsched_backup_last_files_new gauge
+rsched_backup_last_files_new{job="test"} 1
+# HELP rsched_job_attempts_total Total number of attempts of the job, including retries, by error class.
+# TYPE rsched_job_attempts_total counter
+rsched_job_attempts_total{error_class="",job="test",kind="backup"} 1
+rsched_job_attempts_total{error_class="wrong_password",job="test",kind="backup"} 1
+# HELP rsched_job_failures_total Total number of failed runs of the job by error class.
+# TYPE rsched_job_failures_total counter
+rsched_job_failures_total{error_class="wrong_password",job="test",kind="backup"} 1
+# HELP rsched_job_last_run_success Whether the last run of the job was successful (1) or not (0).
+# TYPE rsched_job_last_run_success gauge
+rsched_job_last_run_success{job="test",kind="backup"} 0
+# HELP rsched_job_runs_total Total number of runs of the job.
+# TYPE rsched_job_runs_total counter
+rsched_job_runs_total{job="test",kind="backup"} 2
+`
+	err = testutil.GatherAndCompare(
+		reg,
+		strings.NewReader(expected),
+		"rsched_backup_last_data_added_bytes",
+		"rsched_backup_last_files_changed",
+		"rsched_backup_last_files_new",
+		"rsched_job_attempts_total",
+		"rsched_job_failures_total",
+		"rsched_job_last_run_success",
+		"rsched_job_runs_total",
+	)
+	assert.NoError(t, err)
+
+	n, err := testutil.GatherAndCount(
+		reg,
+		"rsched_job_last_run_timestamp_seconds",
+		"rsched_job_last_run_duration_seconds",
+		"rsched_job_next_run_timestamp_seconds",
+		"rsched_job_planned_start_timestamp_seconds",
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, n)
+}
@@ -2,8 +2,9 @@ package restic
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"strings"
+	"time"
 )
 
 // Names of restic environment variables rsched needs to keep track of.
@@ -25,12 +26,50 @@ var requiredEnvVars = [][]string{
 type Option func(*options)
 
 type options struct {
-	Restic string
-	Runner CmdRunner
-	Env    map[string]string
+	Restic  string
+	Runner  CmdRunner
+	Env     map[string]string
+	JobName string
+	Retry   RetryPolicy
+	Timeout time.Duration
+
+	KillGracePeriod time.Duration
+	Overlap         OverlapPolicy
+	TimeZone        string
+	StartDelay      StartDelay
+	Windows         Windows
+
+	InitPolicy InitPolicy
+	Hooks      Hooks
+
+	Excludes          []string
+	ExcludeFiles      []string
+	IExcludes         []string
+	ExcludeCaches     bool
+	ExcludeIfPresent  []string
+	ExcludeLargerThan string
+	OneFileSystem     bool
+
+	ForgetPolicy ForgetPolicy
+
+	MaxUnused     string
+	MaxRepackSize string
+
+	ReadDataSubset string
+
+	DrillPaths        []string
+	DrillScratchDir   string
+	DrillSampleSize   int
+	DrillVerification DrillVerification
 }
 
 func (o *options) Apply(opts []Option) error {
+	o.apply(opts)
+	return o.Validate()
+}
+
+// apply applies opts without validating the result.
+func (o *options) apply(opts []Option) {
 	// Set defaults. May be overwritten further down the line.
 	o.Restic = "restic"
 	o.Runner = &osRunner{}
@@ -38,8 +77,35 @@ func (o *options) Apply(opts []Option) error {
 	for _, opt := range opts {
 		opt(o)
 	}
+}
 
-	return o.Validate()
+// backupArgs returns the flags passed to restic backup.
+func (o *options) backupArgs() []string {
+	var args []string
+
+	for _, kv := range []struct {
+		flag   string
+		values []string
+	}{
+		{"--exclude", o.Excludes},
+		{"--exclude-file", o.ExcludeFiles},
+		{"--iexclude", o.IExcludes},
+		{"--exclude-if-present", o.ExcludeIfPresent},
+	} {
+		for _, v := range kv.values {
+			args = append(args, kv.flag, v)
+		}
+	}
+	if o.ExcludeCaches {
+		args = append(args, "--exclude-caches")
+	}
+	if o.ExcludeLargerThan != "" {
+		args = append(args, "--exclude-larger-than", o.ExcludeLargerThan)
+	}
+	if o.OneFileSystem {
+		args = append(args, "--one-file-system")
+	}
+	return args
 }
 
 func (o *options) Validate() error {
@@ -56,6 +122,13 @@ func (o *options) Validate() error {
 	return nil
 }
 
+// ValidateOptions returns an error if os lack settings required to call
+// restic, e.g. the repository or the password.
+func ValidateOptions(os ...Option) error {
+	var opts options
+	return opts.Apply(os)
+}
+
 // WithEnv adds the passed key value pairs to the environment that is used
 // to call restic.
 func WithEnv(env map[string]string) Option {
@@ -65,7 +138,7 @@ func WithEnv(env map[string]string) Option {
 		}
 		for k, v := range env {
 			if _, ok := o.Env[k]; ok {
-				log.Printf("Replacing already existing value for %q in restic environment", k)
+				slog.Debug("Replacing already existing value in restic environment", "key", k)
 			}
 			o.Env[k] = v
 		}
@@ -84,6 +157,22 @@ func WithRepository(repo string) Option {
 	return WithEnv(map[string]string{EnvResticRepository: repo})
 }
 
+// WithJobName sets the name of the job an operation belongs to. Scheduler
+// uses the name to identify the job in its log output.
+func WithJobName(name string) Option {
+	return func(opts *options) {
+		opts.JobName = name
+	}
+}
+
+// WithRetryPolicy sets the policy Scheduler uses to retry failed runs of a
+// job.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(opts *options) {
+		opts.Retry = p
+	}
+}
+
 // WithCmdRunner allows to use a specialized command runner.
 //
 // This is intended for testing purposes as it allows to test calls to restic
@@ -100,3 +189,191 @@ func WithBinary(path string) Option {
 		opts.Restic = path
 	}
 }
+
+// WithInitPolicy sets if and when Backup initializes the restic repository.
+func WithInitPolicy(p InitPolicy) Option {
+	return func(opts *options) {
+		opts.InitPolicy = p
+	}
+}
+
+// WithTimeout sets the maximum duration of a single attempt of a job run by
+// Scheduler. A timeout of zero disables it.
+func WithTimeout(d time.Duration) Option {
+	return func(opts *options) {
+		opts.Timeout = d
+	}
+}
+
+// WithKillGracePeriod sets the time restic gets to exit after it was
+// interrupted, e.g. because of a timeout or a shutdown. Restic and all its
+// child processes are killed afterwards. Defaults to
+// DefaultKillGracePeriod.
+func WithKillGracePeriod(d time.Duration) Option {
+	return func(opts *options) {
+		opts.KillGracePeriod = d
+	}
+}
+
+// WithOverlapPolicy sets what happens if a job becomes due while its previous
+// run is still in progress. Defaults to OverlapQueue.
+func WithOverlapPolicy(p OverlapPolicy) Option {
+	return func(opts *options) {
+		opts.Overlap = p
+	}
+}
+
+// WithTimeZone sets the name of the time zone the schedule of a job is
+// evaluated in, e.g. Europe/Berlin. Defaults to the local time zone.
+func WithTimeZone(name string) Option {
+	return func(opts *options) {
+		opts.TimeZone = name
+	}
+}
+
+// WithStartDelay delays the start of each run of a job by up to d.Max.
+func WithStartDelay(d StartDelay) Option {
+	return func(opts *options) {
+		opts.StartDelay = d
+	}
+}
+
+// WithWindows restricts when a job may run. See Windows for details.
+func WithWindows(ws Windows) Option {
+	return func(opts *options) {
+		opts.Windows = ws
+	}
+}
+
+// WithHooks sets the hooks executed by Backup.
+func WithHooks(hs Hooks) Option {
+	return func(opts *options) {
+		opts.Hooks = hs
+	}
+}
+
+// WithExcludes excludes all files matching any of the patterns from the
+// backup.
+//
+// See restic's documentation for the supported patterns
+// (https://restic.readthedocs.io/en/stable/040_backup.html#excluding-files).
+func WithExcludes(patterns ...string) Option {
+	return func(opts *options) {
+		opts.Excludes = append(opts.Excludes, patterns...)
+	}
+}
+
+// WithExcludeFiles excludes all files matching any of the patterns read from
+// files from the backup.
+func WithExcludeFiles(files ...string) Option {
+	return func(opts *options) {
+		opts.ExcludeFiles = append(opts.ExcludeFiles, files...)
+	}
+}
+
+// WithIExcludes works like WithExcludes but ignores the case of the paths.
+func WithIExcludes(patterns ...string) Option {
+	return func(opts *options) {
+		opts.IExcludes = append(opts.IExcludes, patterns...)
+	}
+}
+
+// WithExcludeCaches excludes all directories containing a CACHEDIR.TAG file
+// from the backup.
+func WithExcludeCaches() Option {
+	return func(opts *options) {
+		opts.ExcludeCaches = true
+	}
+}
+
+// WithExcludeIfPresent excludes all directories containing a file with any
+// of the passed names from the backup.
+func WithExcludeIfPresent(names ...string) Option {
+	return func(opts *options) {
+		opts.ExcludeIfPresent = append(opts.ExcludeIfPresent, names...)
+	}
+}
+
+// WithExcludeLargerThan excludes all files larger than size from the backup.
+// The size may be passed with a unit suffix, e.g. 1G.
+func WithExcludeLargerThan(size string) Option {
+	return func(opts *options) {
+		opts.ExcludeLargerThan = size
+	}
+}
+
+// WithOneFileSystem prevents restic from crossing file system boundaries
+// during the backup.
+func WithOneFileSystem() Option {
+	return func(opts *options) {
+		opts.OneFileSystem = true
+	}
+}
+
+// WithForgetPolicy sets the policy used by Forget to decide which snapshots
+// to keep.
+func WithForgetPolicy(p ForgetPolicy) Option {
+	return func(opts *options) {
+		opts.ForgetPolicy = p
+	}
+}
+
+// WithMaxUnused sets the value of the --max-unused flag passed to restic
+// prune.
+//
+// The value may either be an absolute size, e.g. 5G, or a percentage of the
+// repository size, e.g. 5%. See restic's documentation for details.
+func WithMaxUnused(limit string) Option {
+	return func(opts *options) {
+		opts.MaxUnused = limit
+	}
+}
+
+// WithMaxRepackSize sets the value of the --max-repack-size flag passed to
+// restic prune.
+func WithMaxRepackSize(size string) Option {
+	return func(opts *options) {
+		opts.MaxRepackSize = size
+	}
+}
+
+// WithReadDataSubset sets the value of the --read-data-subset flag passed to
+// restic check.
+//
+// The subset is either specified as n/t, meaning the n-th of t parts of the
+// data, or as a percentage or size of the data to read, e.g. 5% or 1G.
+func WithReadDataSubset(subset string) Option {
+	return func(opts *options) {
+		opts.ReadDataSubset = subset
+	}
+}
+
+// WithDrillPaths makes RestoreDrill restore the latest snapshot of paths.
+// paths should be the paths passed to Backup.
+func WithDrillPaths(paths ...string) Option {
+	return func(opts *options) {
+		opts.DrillPaths = paths
+	}
+}
+
+// WithDrillScratchDir sets the directory RestoreDrill restores files into.
+func WithDrillScratchDir(dir string) Option {
+	return func(opts *options) {
+		opts.DrillScratchDir = dir
+	}
+}
+
+// WithDrillSampleSize makes RestoreDrill restore and verify a random sample
+// of n files instead of the whole snapshot.
+func WithDrillSampleSize(n int) Option {
+	return func(opts *options) {
+		opts.DrillSampleSize = n
+	}
+}
+
+// WithDrillVerification sets how RestoreDrill verifies the restored files.
+func WithDrillVerification(v DrillVerification) Option {
+	return func(opts *options) {
+		opts.DrillVerification = v
+	}
+}
@@ -0,0 +1,60 @@
+package restic
+
+import "fmt"
+
+// OverlapPolicy defines what Scheduler does if a job becomes due while its
+// previous run is still in progress or waiting for another job.
+type OverlapPolicy int
+
+// Supported values of OverlapPolicy.
+const (
+	// OverlapQueue queues at most one run of the job. It starts once the
+	// previous run completed. Further runs becoming due in the meantime are
+	// skipped.
+	OverlapQueue OverlapPolicy = iota
+
+	// OverlapSkip skips the run if the previous run is still in progress.
+	OverlapSkip
+
+	// OverlapConcurrent queues runs like OverlapQueue. Additionally the job
+	// does not wait for other jobs targeting a different repository. Jobs
+	// targeting the same repository are never run concurrently.
+	OverlapConcurrent
+)
+
+var overlapPolicyNames = map[OverlapPolicy]string{
+	OverlapQueue:      "queue",
+	OverlapSkip:       "skip",
+	OverlapConcurrent: "concurrent",
+}
+
+// String returns the name of p.
+func (p OverlapPolicy) String() string {
+	return overlapPolicyNames[p]
+}
+
+// Set sets p to the OverlapPolicy called name. This allows to use p as a
+// flag.Value.
+func (p *OverlapPolicy) Set(name string) error {
+	for k, n := range overlapPolicyNames {
+		if n == name {
+			*p = k
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown overlap policy: %q", name)
+}
+
+// UnmarshalText sets p to the OverlapPolicy called text.
+func (p *OverlapPolicy) UnmarshalText(text []byte) error {
+	return p.Set(string(text))
+}
+
+// maxPending returns the maximum number of runs of a job which may be in
+// progress or waiting at the same time.
+func (p OverlapPolicy) maxPending() int {
+	if p == OverlapSkip {
+		return 1
+	}
+	return 2
+}
@@ -0,0 +1,56 @@
+package restic
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// runState describes a run of a job currently executed by Scheduler.
+//
+// The phase of the run is updated by the functions executing the job, e.g.
+// before restic or a hook is started. This allows Scheduler to tell which
+// job was interrupted at which phase during shutdown.
+type runState struct {
+	info  jobInfo
+	runID string
+	start time.Time
+
+	mu    sync.Mutex
+	phase string
+}
+
+type runStateKey struct{}
+
+// withRunState returns a copy of ctx carrying rs.
+func withRunState(ctx context.Context, rs *runState) context.Context {
+	return context.WithValue(ctx, runStateKey{}, rs)
+}
+
+// setPhase sets the phase of the run carried by ctx. It does nothing if ctx
+// does not carry a run.
+func setPhase(ctx context.Context, phase string) {
+	rs, ok := ctx.Value(runStateKey{}).(*runState)
+	if !ok {
+		return
+	}
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	rs.phase = phase
+}
+
+// logAttrs returns the attributes identifying rs in log messages.
+func (rs *runState) logAttrs() []any {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	return []any{
+		slog.String("job", rs.info.Name),
+		slog.String("kind", rs.info.Kind),
+		slog.String("run_id", rs.runID),
+		slog.String("phase", rs.phase),
+		slog.Duration("running_for", time.Since(rs.start)),
+	}
+}
@@ -0,0 +1,183 @@
+package restic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// KindPipeline is the kind of jobs scheduled using Scheduler.SchedulePipeline.
+const KindPipeline = "pipeline"
+
+// StepCondition defines whether a step of a pipeline runs depending on the
+// outcome of the previous steps.
+type StepCondition int
+
+// Supported values of StepCondition.
+const (
+	// StepOnSuccess runs the step only if no previous step failed.
+	StepOnSuccess StepCondition = iota
+
+	// StepAlways runs the step regardless of the outcome of the previous
+	// steps.
+	StepAlways
+
+	// StepOnFailure runs the step only if any previous step failed.
+	StepOnFailure
+)
+
+var stepConditionNames = map[StepCondition]string{
+	StepOnSuccess: "on-success",
+	StepAlways:    "always",
+	StepOnFailure: "on-failure",
+}
+
+// String returns the name of c.
+func (c StepCondition) String() string {
+	return stepConditionNames[c]
+}
+
+// Set sets c to the StepCondition called name. This allows to use c as a
+// flag.Value.
+func (c *StepCondition) Set(name string) error {
+	for k, n := range stepConditionNames {
+		if n == name {
+			*c = k
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown step condition: %q", name)
+}
+
+// UnmarshalText sets c to the StepCondition called text.
+func (c *StepCondition) UnmarshalText(text []byte) error {
+	return c.Set(string(text))
+}
+
+// met returns true if a step with condition c runs. failed tells whether
+// any previous step failed.
+func (c StepCondition) met(failed bool) bool {
+	switch c {
+	case StepAlways:
+		return true
+	case StepOnFailure:
+		return failed
+	default:
+		return !failed
+	}
+}
+
+// PipelineStep is a single restic operation run as part of a pipeline.
+type PipelineStep struct {
+	// Kind is the operation the step runs, i.e. one of KindBackup,
+	// KindForget, KindPrune, KindCheck, or KindRestoreDrill.
+	Kind string
+
+	// Condition decides whether the step runs. Defaults to StepOnSuccess.
+	Condition StepCondition
+
+	// Paths contains the paths backed up by a KindBackup step.
+	Paths []string
+
+	// Subsets is the number of parts the data of the repository is split
+	// into by a KindCheck step. See Scheduler.ScheduleCheck.
+	Subsets int
+
+	// Options are passed to the operation in addition to the options of the
+	// pipeline. They take precedence over the options of the pipeline.
+	Options []Option
+}
+
+// SchedulePipeline ensures steps are run one after the other according to
+// schedule.
+//
+// All steps of a run of the pipeline hold the locks of the job from the
+// start of the first step until the last step completed. No other job,
+// except for jobs with OverlapConcurrent targeting a different repository,
+// runs in between. Each step only runs if its Condition is met. Once the
+// pipeline is interrupted, e.g. by Shutdown, the remaining steps are
+// skipped. The result of each step is logged and recorded in s.Metrics
+// using the kind of the step. Skipped steps are recorded with reason
+// "condition".
+//
+// The options in os apply to the pipeline as well as to each step. The
+// start delay, windows, and overlap policy apply to the pipeline as a
+// whole, while the timeout and retry policy apply to each attempt of a
+// single step. Transient failures of a step are retried without releasing
+// the locks of the pipeline. A run of the pipeline fails if any step
+// fails.
+//
+// See the documentation of the Scheduler type for the definition of schedule.
+func (s *Scheduler) SchedulePipeline(schedule string, steps []PipelineStep, os ...Option) error {
+	if len(steps) == 0 {
+		return errors.New("pipeline: no steps")
+	}
+
+	info := newJobInfo(KindPipeline, os)
+	// Timeouts and retries apply to the individual steps.
+	info.Timeout, info.Retry = 0, RetryPolicy{}
+	funcs := make([]func(context.Context) error, len(steps))
+	infos := make([]jobInfo, len(steps))
+	for i, step := range steps {
+		sos := append(os[:len(os):len(os)], step.Options...)
+		infos[i] = newJobInfo(step.Kind, sos)
+		if err := infos[i].Retry.Validate(); err != nil {
+			return fmt.Errorf("pipeline step %d: %w", i+1, err)
+		}
+		switch step.Kind {
+		case KindBackup:
+			funcs[i] = s.backupFunc(infos[i], step.Paths, sos)
+		case KindForget:
+			funcs[i] = s.forgetFunc(sos)
+		case KindPrune:
+			funcs[i] = s.pruneFunc(sos)
+		case KindCheck:
+			funcs[i] = s.checkFunc(infos[i], step.Subsets, sos)
+		case KindRestoreDrill:
+			funcs[i] = s.restoreDrillFunc(sos)
+		default:
+			return fmt.Errorf("pipeline step %d: unknown operation: %q", i+1, step.Kind)
+		}
+	}
+
+	return s.scheduleFunc(schedule, info, func(ctx context.Context) error {
+		var errs []error
+
+		for i, step := range steps {
+			sctx := withLogger(ctx, logger(ctx).With("step", i+1, "step_kind", step.Kind))
+			if ctx.Err() != nil {
+				logger(sctx).Warn("Skipping remaining steps", "error", ctx.Err())
+				errs = append(errs, ctx.Err())
+				break
+			}
+			if !step.Condition.met(len(errs) > 0) {
+				logger(sctx).Info("Skipping step", "condition", step.Condition)
+				s.Metrics.observeSkippedRun(infos[i], "condition")
+				continue
+			}
+			if err := s.runStep(sctx, infos[i], funcs[i]); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", step.Kind, err))
+			}
+		}
+		return errors.Join(errs...)
+	})
+}
+
+// runStep runs f as a step of a pipeline using Scheduler.retryAttempts.
+// The locks of the pipeline are held while waiting for the next attempt.
+// The result of the step is logged and recorded in s.Metrics.
+func (s *Scheduler) runStep(ctx context.Context, info jobInfo, f func(context.Context) error) error {
+	log := logger(ctx)
+	log.Info("Beginning step")
+	start := time.Now()
+	err := s.retryAttempts(ctx, info, f, nil, nil)
+	duration := time.Since(start)
+	s.Metrics.observeRun(info, start, duration, err)
+	if err != nil {
+		log.Error("Step failed", "duration", duration, "error", err, "error_class", ErrorClass(err))
+		return err
+	}
+	log.Info("Step completed", "duration", duration)
+	return nil
+}
@@ -0,0 +1,194 @@
+package restic_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fhofherr/rsched/internal/restic"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScheduler_SchedulePipeline(t *testing.T) {
+	tests := []struct {
+		name    string
+		steps   []restic.PipelineStep
+		results map[string]error
+		calls   []string
+		err     error
+		metrics string
+	}{
+		{
+			name: "run all steps",
+			steps: []restic.PipelineStep{
+				{Kind: restic.KindBackup, Paths: []string{"/some/path"}},
+				{
+					Kind:    restic.KindForget,
+					Options: []restic.Option{restic.WithForgetPolicy(restic.ForgetPolicy{KeepLast: 1})},
+				},
+				{Kind: restic.KindPrune},
+				{Kind: restic.KindCheck},
+			},
+			calls: []string{"backup", "forget", "prune", "check"},
+			metrics: `
+# HELP rsched_job_runs_total Total number of runs of the job.
+# TYPE rsched_job_runs_total counter
+rsched_job_runs_total{job="test",kind="backup"} 1
+rsched_job_runs_total{job="test",kind="check"} 1
+rsched_job_runs_total{job="test",kind="forget"} 1
+rsched_job_runs_total{job="test",kind="pipeline"} 1
+rsched_job_runs_total{job="test",kind="prune"} 1
+`,
+		},
+		{
+			name: "skip steps after failure",
+			steps: []restic.PipelineStep{
+				{Kind: restic.KindBackup, Paths: []string{"/some/path"}},
+				{Kind: restic.KindForget},
+				{Kind: restic.KindCheck, Condition: restic.StepAlways},
+				{Kind: restic.KindRestoreDrill, Condition: restic.StepOnFailure},
+			},
+			results: map[string]error{"backup": restic.Error{Command: "backup", ExitCode: 12}},
+			calls:   []string{"backup", "check", "restore drill"},
+			err:     restic.ErrWrongPassword,
+			metrics: `
+# HELP rsched_job_failures_total Total number of failed runs of the job by error class.
+# TYPE rsched_job_failures_total counter
+rsched_job_failures_total{error_class="wrong_password",job="test",kind="backup"} 1
+rsched_job_failures_total{error_class="wrong_password",job="test",kind="pipeline"} 1
+# HELP rsched_job_runs_total Total number of runs of the job.
+# TYPE rsched_job_runs_total counter
+rsched_job_runs_total{job="test",kind="backup"} 1
+rsched_job_runs_total{job="test",kind="check"} 1
+rsched_job_runs_total{job="test",kind="pipeline"} 1
+rsched_job_runs_total{job="test",kind="restore drill"} 1
+# HELP rsched_job_skipped_runs_total Total number of skipped runs of the job by reason.
+# TYPE rsched_job_skipped_runs_total counter
+rsched_job_skipped_runs_total{job="test",kind="forget",reason="condition"} 1
+`,
+		},
+		{
+			name: "skip on-failure steps",
+			steps: []restic.PipelineStep{
+				{Kind: restic.KindPrune},
+				{Kind: restic.KindCheck, Condition: restic.StepOnFailure},
+			},
+			calls: []string{"prune"},
+			metrics: `
+# HELP rsched_job_runs_total Total number of runs of the job.
+# TYPE rsched_job_runs_total counter
+rsched_job_runs_total{job="test",kind="pipeline"} 1
+rsched_job_runs_total{job="test",kind="prune"} 1
+# HELP rsched_job_skipped_runs_total Total number of skipped runs of the job by reason.
+# TYPE rsched_job_skipped_runs_total counter
+rsched_job_skipped_runs_total{job="test",kind="check",reason="condition"} 1
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []string
+			call := func(kind string) error {
+				calls = append(calls, kind)
+				return tt.results[kind]
+			}
+			reg := prometheus.NewPedanticRegistry()
+			s := &restic.Scheduler{
+				BackupFunc: func(
+					ctx context.Context, paths []string, os ...restic.Option,
+				) (restic.BackupSummary, error) {
+					return restic.BackupSummary{}, call("backup")
+				},
+				ForgetFunc: func(ctx context.Context, os ...restic.Option) error {
+					return call("forget")
+				},
+				PruneFunc: func(ctx context.Context, os ...restic.Option) error {
+					return call("prune")
+				},
+				CheckFunc: func(ctx context.Context, os ...restic.Option) error {
+					return call("check")
+				},
+				RestoreDrillFunc: func(ctx context.Context, os ...restic.Option) (restic.DrillReport, error) {
+					return restic.DrillReport{}, call("restore drill")
+				},
+				Metrics: restic.NewMetrics(reg),
+			}
+
+			err := s.SchedulePipeline(restic.ScheduleOnce, tt.steps, restic.WithJobName("test"))
+			if !assert.NoError(t, err) {
+				return
+			}
+			err = s.Run()
+			assert.Equal(t, tt.calls, calls)
+			if tt.err == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.err)
+			}
+			err = testutil.GatherAndCompare(
+				reg,
+				strings.NewReader(tt.metrics),
+				"rsched_job_runs_total", "rsched_job_failures_total", "rsched_job_skipped_runs_total",
+			)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestScheduler_SchedulePipeline_Retry(t *testing.T) {
+	var attempts int
+	s := &restic.Scheduler{
+		BackupFunc: func(ctx context.Context, paths []string, os ...restic.Option) (restic.BackupSummary, error) {
+			return restic.BackupSummary{}, nil
+		},
+		PruneFunc: func(ctx context.Context, os ...restic.Option) error {
+			attempts++
+			if attempts == 1 {
+				return restic.Error{Command: "prune", ExitCode: 11}
+			}
+			return nil
+		},
+	}
+	steps := []restic.PipelineStep{
+		{Kind: restic.KindBackup, Paths: []string{"/some/path"}},
+		{Kind: restic.KindPrune},
+	}
+
+	policy := restic.RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	err := s.SchedulePipeline(restic.ScheduleOnce, steps, restic.WithRetryPolicy(policy))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, s.Run())
+	assert.Equal(t, 2, attempts)
+}
+
+func TestScheduler_SchedulePipeline_Invalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []restic.PipelineStep
+	}{
+		{
+			name: "no steps",
+		},
+		{
+			name:  "unknown operation",
+			steps: []restic.PipelineStep{{Kind: "unlock"}},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			s := &restic.Scheduler{}
+			defer s.Shutdown()
+
+			assert.Error(t, s.SchedulePipeline("@daily", tt.steps))
+		})
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !unix
+
+package restic
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup does nothing on platforms without process groups.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// signalGroup sends sig to p. Child processes of p are not signaled on
+// platforms without process groups.
+func signalGroup(p *os.Process, sig syscall.Signal) error {
+	if sig == syscall.SIGKILL {
+		return p.Kill()
+	}
+	return p.Signal(sig)
+}
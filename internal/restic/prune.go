@@ -0,0 +1,33 @@
+package restic
+
+import (
+	"context"
+	"fmt"
+)
+
+// Prune calls restic prune to remove data no longer referenced by any
+// snapshot from the repository.
+//
+// The amount of unused space tolerated in the repository can be controlled
+// using WithMaxUnused. WithMaxRepackSize limits the amount of data repacked
+// during a single run of Prune.
+//
+// Prune requires an exclusive lock on the repository. Use Scheduler to avoid
+// concurrent invocations of other restic commands against the same
+// repository.
+func Prune(ctx context.Context, os ...Option) error {
+	var opts options
+
+	if err := opts.Apply(os); err != nil {
+		return fmt.Errorf("prune options: %v", err)
+	}
+
+	args := []string{"prune"}
+	if opts.MaxUnused != "" {
+		args = append(args, "--max-unused", opts.MaxUnused)
+	}
+	if opts.MaxRepackSize != "" {
+		args = append(args, "--max-repack-size", opts.MaxRepackSize)
+	}
+	return runRestic(ctx, opts, args...)
+}
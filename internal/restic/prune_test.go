@@ -0,0 +1,92 @@
+package restic_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fhofherr/rsched/internal/restic"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrune(t *testing.T) {
+	tests := []restic.TestCase{
+		{
+			Name:     "prune with defaults",
+			Repo:     "/path/to/repository",
+			Password: "super secret",
+			Invocations: func(t *testing.T, tt *restic.TestCase) []restic.ExpectedInvocation {
+				return []restic.ExpectedInvocation{
+					{
+						Args: []string{"restic", "prune"},
+						Env: map[string]string{
+							"RESTIC_REPOSITORY": tt.Repo,
+							"RESTIC_PASSWORD":   tt.Password,
+						},
+					},
+				}
+			},
+			Perform: func(t *testing.T, tt *restic.TestCase) {
+				tt.Options = append(tt.Options, restic.WithRepository(tt.Repo), restic.WithPassword(tt.Password))
+				err := restic.Prune(context.Background(), tt.Options...)
+				assert.NoError(t, err)
+			},
+		},
+		{
+			Name:     "prune with limits",
+			Repo:     "/path/to/repository",
+			Password: "super secret",
+			Invocations: func(t *testing.T, tt *restic.TestCase) []restic.ExpectedInvocation {
+				return []restic.ExpectedInvocation{
+					{
+						Args: []string{"restic", "prune", "--max-unused", "10%", "--max-repack-size", "2G"},
+						Env: map[string]string{
+							"RESTIC_REPOSITORY": tt.Repo,
+							"RESTIC_PASSWORD":   tt.Password,
+						},
+					},
+				}
+			},
+			Perform: func(t *testing.T, tt *restic.TestCase) {
+				tt.Options = append(
+					tt.Options,
+					restic.WithRepository(tt.Repo),
+					restic.WithPassword(tt.Password),
+					restic.WithMaxUnused("10%"),
+					restic.WithMaxRepackSize("2G"),
+				)
+				err := restic.Prune(context.Background(), tt.Options...)
+				assert.NoError(t, err)
+			},
+		},
+		{
+			Name:     "repository locked",
+			Repo:     "/path/to/repository",
+			Password: "super secret",
+			Invocations: func(t *testing.T, tt *restic.TestCase) []restic.ExpectedInvocation {
+				return []restic.ExpectedInvocation{
+					{
+						Args: []string{"restic", "prune"},
+						Env: map[string]string{
+							"RESTIC_REPOSITORY": tt.Repo,
+							"RESTIC_PASSWORD":   tt.Password,
+						},
+						Code: 1,
+					},
+				}
+			},
+			Perform: func(t *testing.T, tt *restic.TestCase) {
+				tt.Options = append(tt.Options, restic.WithRepository(tt.Repo), restic.WithPassword(tt.Password))
+				err := restic.Prune(context.Background(), tt.Options...)
+				assert.ErrorIs(t, err, restic.Error{
+					Command:  "prune",
+					ExitCode: 1,
+				})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.Name, tt.Run)
+	}
+}
@@ -0,0 +1,87 @@
+package restic
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Defaults used by RetryPolicy if the respective value is zero.
+const (
+	DefaultInitialBackoff = 30 * time.Second
+	DefaultMaxBackoff     = 10 * time.Minute
+)
+
+// RetryPolicy defines how often and when Scheduler retries a failed job.
+//
+// Jobs are only retried if they failed with a transient error, see
+// IsTransient. The delay before the n-th retry is InitialBackoff * 2^(n-1),
+// but at most MaxBackoff. If Jitter is greater than zero the delay is
+// randomly changed by up to Jitter times its value in either direction.
+// This prevents several hosts failing at the same time from retrying in
+// lockstep.
+//
+// The zero value of RetryPolicy disables retries.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts of a single run of the
+	// job, including the first one. Values less than two disable retries.
+	MaxAttempts    int           `yaml:"max_attempts"`
+	InitialBackoff time.Duration `yaml:"initial_backoff"`
+	MaxBackoff     time.Duration `yaml:"max_backoff"`
+
+	// Jitter is a fraction between 0 and 1.
+	Jitter float64 `yaml:"jitter"`
+}
+
+// Validate checks if p contains valid values.
+func (p RetryPolicy) Validate() error {
+	if p.MaxAttempts < 0 {
+		return fmt.Errorf("retry: negative max attempts: %d", p.MaxAttempts)
+	}
+	if p.InitialBackoff < 0 || p.MaxBackoff < 0 {
+		return errors.New("retry: negative backoff")
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		return fmt.Errorf("retry: jitter not between 0 and 1: %v", p.Jitter)
+	}
+	return nil
+}
+
+// backoff returns the delay before the retry following the passed attempt.
+// The first attempt is 1. rnd returns a random number in [0, 1).
+func (p RetryPolicy) backoff(attempt int, rnd func() float64) time.Duration {
+	initial, max := p.InitialBackoff, p.MaxBackoff
+	if initial == 0 {
+		initial = DefaultInitialBackoff
+	}
+	if max == 0 {
+		max = DefaultMaxBackoff
+	}
+	if max < initial {
+		max = initial
+	}
+
+	d := initial
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	if p.Jitter > 0 {
+		d += time.Duration(p.Jitter * (2*rnd() - 1) * float64(d))
+	}
+	return d
+}
+
+// IsTransient returns true if err is caused by a condition which may go away
+// on its own, e.g. a locked repository or an unreachable backend. Errors
+// which require human intervention, e.g. a wrong password, are not
+// transient. Neither are timeouts or runs interrupted because their window
+// closed.
+func IsTransient(err error) bool {
+	if errors.Is(err, ErrTimeout) || errors.Is(err, ErrWindowClosed) {
+		return false
+	}
+	return errors.Is(err, ErrRepoLocked) || errors.Is(err, ErrBackendUnreachable)
+}
@@ -0,0 +1,97 @@
+package restic
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   RetryPolicy
+		attempt  int
+		rnd      float64
+		expected time.Duration
+	}{
+		{
+			name:     "first retry uses initial backoff",
+			policy:   RetryPolicy{InitialBackoff: time.Second, MaxBackoff: time.Minute},
+			attempt:  1,
+			expected: time.Second,
+		},
+		{
+			name:     "backoff doubles with every attempt",
+			policy:   RetryPolicy{InitialBackoff: time.Second, MaxBackoff: time.Minute},
+			attempt:  4,
+			expected: 8 * time.Second,
+		},
+		{
+			name:     "backoff is capped",
+			policy:   RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second},
+			attempt:  10,
+			expected: 5 * time.Second,
+		},
+		{
+			name:     "defaults",
+			policy:   RetryPolicy{},
+			attempt:  1,
+			expected: DefaultInitialBackoff,
+		},
+		{
+			name:     "max backoff less than initial backoff",
+			policy:   RetryPolicy{InitialBackoff: time.Minute, MaxBackoff: time.Second},
+			attempt:  3,
+			expected: time.Minute,
+		},
+		{
+			name:     "negative jitter",
+			policy:   RetryPolicy{InitialBackoff: 10 * time.Second, MaxBackoff: time.Minute, Jitter: 0.5},
+			attempt:  1,
+			rnd:      0,
+			expected: 5 * time.Second,
+		},
+		{
+			name:     "positive jitter",
+			policy:   RetryPolicy{InitialBackoff: 10 * time.Second, MaxBackoff: time.Minute, Jitter: 0.5},
+			attempt:  1,
+			rnd:      0.75,
+			expected: 12500 * time.Millisecond,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			actual := tt.policy.backoff(tt.attempt, func() float64 { return tt.rnd })
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestRetryPolicy_Validate(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy RetryPolicy
+		valid  bool
+	}{
+		{name: "zero value", valid: true},
+		{name: "valid", policy: RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Second, Jitter: 1}, valid: true},
+		{name: "negative max attempts", policy: RetryPolicy{MaxAttempts: -1}},
+		{name: "negative backoff", policy: RetryPolicy{MaxBackoff: -time.Second}},
+		{name: "jitter too large", policy: RetryPolicy{Jitter: 1.5}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Validate()
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
@@ -4,8 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"math/rand"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/robfig/cron/v3"
 )
@@ -14,97 +17,523 @@ import (
 // be executed only once.
 const ScheduleOnce = "once"
 
+// scheduleParser parses cron expressions with an optional seconds field.
+var scheduleParser = cron.NewParser(
+	cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor,
+)
+
+// ValidateSchedule returns an error if schedule is neither ScheduleOnce nor
+// a valid cron expression. See Scheduler for details.
+func ValidateSchedule(schedule string) error {
+	if schedule == ScheduleOnce {
+		return nil
+	}
+	_, err := parseSchedule(schedule, "")
+	return err
+}
+
+// parseSchedule parses the cron expression schedule. The schedule is
+// evaluated in the time zone called tz unless schedule starts with a
+// CRON_TZ= prefix. An empty tz refers to the local time zone.
+func parseSchedule(schedule, tz string) (cron.Schedule, error) {
+	sched, err := scheduleParser.Parse(schedule)
+	if err != nil {
+		return nil, err
+	}
+	if tz == "" || strings.HasPrefix(schedule, "CRON_TZ=") || strings.HasPrefix(schedule, "TZ=") {
+		return sched, nil
+	}
+	loc, err := loadLocation(tz)
+	if err != nil {
+		return nil, err
+	}
+	if spec, ok := sched.(*cron.SpecSchedule); ok {
+		spec.Location = loc
+	}
+	return sched, nil
+}
+
+// loadLocation returns the time zone called tz. An empty tz refers to the
+// local time zone.
+func loadLocation(tz string) (*time.Location, error) {
+	if tz == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("time zone: %v", err)
+	}
+	return loc, nil
+}
+
 // Scheduler takes care of scheduling the various restic commands and handling
 // graceful shutdown.
 //
+// Scheduler never runs more than one job at any time. Jobs which become due
+// while another job is running wait until the running job is completed. This
+// ensures that jobs requiring an exclusive lock on the repository, e.g.
+// prune, do not fail because a backup holds a lock on the same repository
+// and vice versa. Jobs with OverlapConcurrent are the exception, they only
+// wait for jobs targeting the same repository. See WithOverlapPolicy.
+//
 // Schedule Argument
 //
 // Some methods of Scheduler expect a schedule argument of type string. The
 // value of schedule may either be a valid cron expresssion as supported by
 // github.com/robfig/cron or the special value "once". Passing "once" leads
-// to the respective function being executed immediately in a separate go
-// routine.
+// to the respective function being executed once Run is called. See Run for
+// details.
+//
+// Cron expressions may start with an optional seconds field, e.g.
+// "30 0 3 * * *" runs at 03:00:30. They are evaluated in the time zone set
+// using WithTimeZone, or the local time zone if none is set. A CRON_TZ=
+// prefix, e.g. "CRON_TZ=Europe/Berlin 0 3 * * *", takes precedence over
+// both.
 type Scheduler struct {
 	// The function that is called whenever it is time to create a backup.
 	// Defaults to Backup.
-	BackupFunc func(ctx context.Context, path string, os ...Option) error
+	BackupFunc func(ctx context.Context, paths []string, os ...Option) (BackupSummary, error)
+
+	// The function that is called whenever it is time to remove old
+	// snapshots. Defaults to Forget.
+	ForgetFunc func(ctx context.Context, os ...Option) error
+
+	// The function that is called whenever it is time to prune the
+	// repository. Defaults to Prune.
+	PruneFunc func(ctx context.Context, os ...Option) error
+
+	// The function that is called whenever it is time to check the
+	// repository. Defaults to Check.
+	CheckFunc func(ctx context.Context, os ...Option) error
+
+	// The function that is called whenever it is time for a restore drill.
+	// Defaults to RestoreDrill.
+	RestoreDrillFunc func(ctx context.Context, os ...Option) (DrillReport, error)
+
+	// Metrics records the results of all jobs if set.
+	Metrics *Metrics
+
+	// ShutdownTimeout is the maximum time Shutdown waits for the running job
+	// to complete. Shutdown waits indefinitely if this is zero.
+	ShutdownTimeout time.Duration
+
+	// State persists the start and result of each run if set.
+	State *State
+
+	// CatchUpWindow enables catching up on runs missed while rsched was not
+	// running. Jobs which should have run within CatchUpWindow before they
+	// are scheduled, but did not succeed since, run once Run is called.
+	// Requires State to be set. Disabled if this is zero.
+	CatchUpWindow time.Duration
 
 	once       sync.Once
 	cron       *cron.Cron
 	sempaphore chan struct{}
 	shutdown   chan struct{}
+	done       chan struct{}
+	onceJobs   []func() error
+	catchUp    []func() error
+
+	mu          sync.Mutex
+	running     bool
+	active      map[*runState]struct{}
+	drained     chan struct{}
+	repoLocks   map[string]chan struct{}
+	shutdownErr error
+	lastBackups map[string]time.Time
 }
 
+// ErrShutdownTimeout is returned by Run if Shutdown did not wait for the
+// running job to complete because ShutdownTimeout expired.
+var ErrShutdownTimeout = errors.New("shutdown timed out")
+
+// Kinds of operations run by Scheduler. The kind of an operation is
+// included in the log messages and metrics of the respective job.
+const (
+	KindBackup       = "backup"
+	KindForget       = "forget"
+	KindPrune        = "prune"
+	KindCheck        = "check"
+	KindRestoreDrill = "restore drill"
+)
+
 // ScheduleBackup ensures the BackupFunc is being called according to schedule.
 //
 // See the documentation of the Scheduler type for the definition of schedule.
-func (s *Scheduler) ScheduleBackup(schedule, path string, os ...Option) error {
-	return s.scheduleFunc(schedule, func(ctx context.Context) {
-		log.Println("Beginning backup")
-		if err := s.BackupFunc(ctx, path, os...); err != nil {
-			var rErr Error
-
-			log.Printf("Error during backup: %v", err)
-			if errors.As(err, &rErr) && len(rErr.Stderr) > 0 {
-				log.Printf("Restic stderr: %s", string(rErr.Stderr))
-			}
-			return
+func (s *Scheduler) ScheduleBackup(schedule string, paths []string, os ...Option) error {
+	info := newJobInfo(KindBackup, os)
+	return s.scheduleFunc(schedule, info, s.backupFunc(info, paths, os))
+}
+
+// backupFunc returns a function calling BackupFunc for the job described
+// by info. It records the time of the last backup of the job as well as
+// the metrics of the created snapshot.
+func (s *Scheduler) backupFunc(info jobInfo, paths []string, os []Option) func(context.Context) error {
+	s.init()
+	js, _ := s.State.Job(info.Name, KindBackup)
+	s.mu.Lock()
+	if _, ok := s.lastBackups[info.Name]; !ok {
+		s.lastBackups[info.Name] = js.LastSuccess
+	}
+	s.mu.Unlock()
+
+	return func(ctx context.Context) error {
+		summary, err := s.BackupFunc(ctx, paths, os...)
+		if summary.SnapshotID != "" {
+			s.mu.Lock()
+			s.lastBackups[info.Name] = time.Now()
+			s.mu.Unlock()
+
+			s.Metrics.observeBackup(info, summary)
+			logger(ctx).Info(
+				"Backup created snapshot",
+				"snapshot_id", summary.SnapshotID,
+				"files_new", summary.FilesNew,
+				"files_changed", summary.FilesChanged,
+				"files_unmodified", summary.FilesUnmodified,
+				"data_added", summary.DataAdded,
+				"total_files_processed", summary.TotalFilesProcessed,
+				"total_bytes_processed", summary.TotalBytesProcessed,
+				"total_duration", summary.TotalDuration,
+			)
 		}
-		log.Println("Backup successfully completed")
-	})
+		return err
+	}
+}
+
+// ScheduleForget ensures the ForgetFunc is being called according to
+// schedule.
+//
+// The snapshots to keep need to be passed using WithForgetPolicy. See the
+// documentation of the Scheduler type for the definition of schedule.
+func (s *Scheduler) ScheduleForget(schedule string, os ...Option) error {
+	return s.scheduleFunc(schedule, newJobInfo(KindForget, os), s.forgetFunc(os))
+}
+
+func (s *Scheduler) forgetFunc(os []Option) func(context.Context) error {
+	return func(ctx context.Context) error {
+		return s.ForgetFunc(ctx, os...)
+	}
+}
+
+// SchedulePrune ensures the PruneFunc is being called according to schedule.
+//
+// See the documentation of the Scheduler type for the definition of schedule.
+func (s *Scheduler) SchedulePrune(schedule string, os ...Option) error {
+	return s.scheduleFunc(schedule, newJobInfo(KindPrune, os), s.pruneFunc(os))
+}
+
+func (s *Scheduler) pruneFunc(os []Option) func(context.Context) error {
+	return func(ctx context.Context) error {
+		return s.PruneFunc(ctx, os...)
+	}
+}
+
+// ScheduleCheck ensures the CheckFunc is being called according to schedule.
+//
+// If subsets is greater than zero the data in the repository is split into
+// subsets parts. Each invocation of CheckFunc reads and verifies the part
+// following the one last checked successfully using WithReadDataSubset.
+// After the last part was checked the rotation starts over with the first
+// part. Any WithReadDataSubset option passed in os is overridden in this
+// case. If State is set the rotation continues across restarts.
+//
+// See the documentation of the Scheduler type for the definition of schedule.
+func (s *Scheduler) ScheduleCheck(schedule string, subsets int, os ...Option) error {
+	info := newJobInfo(KindCheck, os)
+	return s.scheduleFunc(schedule, info, s.checkFunc(info, subsets, os))
+}
+
+// checkFunc returns a function calling CheckFunc for the job described by
+// info. See ScheduleCheck for the meaning of subsets.
+func (s *Scheduler) checkFunc(info jobInfo, subsets int, os []Option) func(context.Context) error {
+	var last int
+
+	return func(ctx context.Context) error {
+		if subsets <= 0 {
+			return s.CheckFunc(ctx, os...)
+		}
+		// No synchronization necessary, as runs of the same job never
+		// overlap.
+		if js, ok := s.State.Job(info.Name, info.Kind); ok {
+			last = js.LastSubset
+		}
+		n := last%subsets + 1
+		subset := fmt.Sprintf("%d/%d", n, subsets)
+		logger(ctx).Info("Checking data subset", "subset", subset)
+		err := s.CheckFunc(ctx, append(os[:len(os):len(os)], WithReadDataSubset(subset))...)
+		if err != nil {
+			return err
+		}
+		last = n
+		if sErr := s.State.recordSubset(info, n); sErr != nil {
+			logger(ctx).Warn("Failed to save state", "error", sErr)
+		}
+		return nil
+	}
+}
+
+// ScheduleRestoreDrill ensures the RestoreDrillFunc is being called
+// according to schedule.
+//
+// The report of every restore drill is logged. See the documentation of the
+// Scheduler type for the definition of schedule.
+func (s *Scheduler) ScheduleRestoreDrill(schedule string, os ...Option) error {
+	return s.scheduleFunc(schedule, newJobInfo(KindRestoreDrill, os), s.restoreDrillFunc(os))
+}
+
+func (s *Scheduler) restoreDrillFunc(os []Option) func(context.Context) error {
+	return func(ctx context.Context) error {
+		report, err := s.RestoreDrillFunc(ctx, os...)
+		if report.SnapshotID != "" {
+			logger(ctx).Info(
+				"Restore drill completed",
+				"snapshot_id", report.SnapshotID,
+				"restored", report.Restored,
+				"verified", report.Verified,
+				"skipped", report.Skipped,
+			)
+		}
+		for _, m := range report.Mismatches {
+			logger(ctx).Warn("Restore drill mismatch", "path", m.Path, "reason", m.Reason)
+		}
+		return err
+	}
 }
 
 // Run starts the Scheduler in the calling go routine.
-func (s *Scheduler) Run() {
+//
+// Run first executes all jobs scheduled using ScheduleOnce synchronously and
+// in the order they were scheduled. If no other jobs are scheduled Run
+// returns afterwards. Otherwise Run blocks until Shutdown is completed.
+// Jobs which missed a run while rsched was not running are started in the
+// background, see CatchUpWindow.
+//
+// Run returns the errors of all jobs scheduled using ScheduleOnce joined
+// into a single error. Errors of all other jobs are only logged. If the
+// ShutdownTimeout expired the returned error wraps ErrShutdownTimeout.
+func (s *Scheduler) Run() error {
+	s.init()
+	s.setRunning(true)
+	defer s.setRunning(false)
+
+	var errs []error
+	for _, job := range s.onceJobs {
+		errs = append(errs, job())
+	}
+	err := errors.Join(errs...)
+	if len(s.cron.Entries()) == 0 {
+		return errors.Join(err, s.shutdownError())
+	}
+
+	s.mu.Lock()
+	select {
+	case <-s.shutdown:
+		s.mu.Unlock()
+		return errors.Join(err, s.shutdownError())
+	default:
+	}
+	s.cron.Start()
+	s.mu.Unlock()
+	go s.runCatchUp()
+
+	<-s.done
+	return errors.Join(err, s.shutdownError())
+}
+
+func (s *Scheduler) shutdownError() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.shutdownErr
+}
+
+// Running returns true if Run was called and Shutdown was not yet called.
+func (s *Scheduler) Running() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.running
+}
+
+func (s *Scheduler) setRunning(running bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.running = running
+}
+
+// LastBackups returns the time the last backup was created for every job
+// with a scheduled backup. The job names are used as keys of the returned
+// map. If State is set the time of the last successful backup recorded
+// before the Scheduler started is reported until the job creates a new
+// backup. Jobs without any backup report the zero time.
+func (s *Scheduler) LastBackups() map[string]time.Time {
 	s.init()
-	s.cron.Run()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := make(map[string]time.Time, len(s.lastBackups))
+	for name, t := range s.lastBackups {
+		res[name] = t
+	}
+	return res
 }
 
 // Shutdown performs a graceful shutdown of the Scheduler.
 //
-// Any currently running jobs get notified of the imminent shutdown. Currently
-// running invocations of restic may get a signal sent using kill.
+// Any currently running jobs get notified of the imminent shutdown. This
+// interrupts any running invocation of restic. See WithKillGracePeriod.
 //
 // Shutdown blocks the calling go routine until all currently running tasks
-// are completed.
+// are completed, but at most for ShutdownTimeout if it is greater than
+// zero. Once the timeout expires restic is killed and Shutdown returns
+// without waiting for the job any longer.
 func (s *Scheduler) Shutdown() {
 	s.init() // Call init to ensure s.shutdown exists even if nothing was scheduled
+	defer close(s.done)
 
+	s.mu.Lock()
+	s.running = false
 	close(s.shutdown)
+	active := s.activeRuns()
+	// No run becomes active once s.shutdown is closed. Thus waiting for
+	// s.drained waits for all running jobs.
+	var drained chan struct{}
+	if len(active) > 0 {
+		s.drained = make(chan struct{})
+		drained = s.drained
+	}
+	s.mu.Unlock()
 	s.cron.Stop()
+	for _, rs := range active {
+		slog.Info("Shutting down, interrupting running job", rs.logAttrs()...)
+	}
+	if drained == nil {
+		return
+	}
+
+	var timeout <-chan time.Time
+	if s.ShutdownTimeout > 0 {
+		timer := time.NewTimer(s.ShutdownTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-drained:
+		return
+	case <-timeout:
+	}
+
+	s.mu.Lock()
+	s.shutdownErr = fmt.Errorf("%w after %s", ErrShutdownTimeout, s.ShutdownTimeout)
+	active = s.activeRuns()
+	s.mu.Unlock()
+	for _, rs := range active {
+		slog.Error("Shutdown timed out, killing running job", rs.logAttrs()...)
+	}
+	killInterrupted()
+}
+
+// Kill immediately kills all invocations of restic interrupted by Shutdown
+// together with their child processes. It does not wait for the jobs to
+// complete.
+//
+// Kill is intended to be called if Shutdown takes too long, e.g. because
+// the user asked a second time to stop rsched.
+func (s *Scheduler) Kill() {
+	s.mu.Lock()
+	active := s.activeRuns()
+	s.mu.Unlock()
+	for _, rs := range active {
+		slog.Warn("Killing running job", rs.logAttrs()...)
+	}
+	killInterrupted()
+}
 
-	// Wait for all jobs to finish by acquiring the semaphore. This only works
-	// as long as the semaphore can be acquired only once. Should this change
-	// we need to acquire the semaphore as often as the sempaphore is buffered.
-	s.acquireSemaphore(context.Background())
+// activeRuns returns all runs currently holding their locks. The caller
+// must hold s.mu.
+func (s *Scheduler) activeRuns() []*runState {
+	res := make([]*runState, 0, len(s.active))
+	for rs := range s.active {
+		res = append(res, rs)
+	}
+	return res
 }
 
-func (s *Scheduler) scheduleFunc(schedule string, f func(context.Context)) error {
+func (s *Scheduler) scheduleFunc(schedule string, info jobInfo, f func(context.Context) error) error {
 	s.init()
 
-	log.Printf("Adding job with schedule %q", schedule)
-	job := s.newJob(f)
+	if err := info.Retry.Validate(); err != nil {
+		return err
+	}
+	if err := info.StartDelay.Validate(); err != nil {
+		return err
+	}
+	if err := info.Windows.Validate(); err != nil {
+		return err
+	}
+	loc, err := loadLocation(info.TimeZone)
+	if err != nil {
+		return err
+	}
+	info.Location = loc
+	slog.Info("Adding job", "job", info.Name, "kind", info.Kind, "schedule", schedule)
 	if schedule == ScheduleOnce {
-		go job()
+		s.onceJobs = append(s.onceJobs, s.newJob(info, nil, f))
 		return nil
 	}
-	if _, err := s.cron.AddFunc(schedule, job); err != nil {
+	sched, err := parseSchedule(schedule, info.TimeZone)
+	if err != nil {
 		return fmt.Errorf("add cron entry: %v", err)
 	}
+	job := s.newJob(info, sched, f)
+	s.cron.Schedule(sched, cron.FuncJob(func() {
+		_ = job() // Errors are logged by the job itself.
+	}))
+	s.Metrics.observeNextRun(info, sched.Next(time.Now()))
+	if missed, ok := s.State.missedRun(info, sched, time.Now(), s.CatchUpWindow); ok {
+		slog.Info("Missed run, catching up", "job", info.Name, "kind", info.Kind, "missed", missed)
+		s.catchUp = append(s.catchUp, job)
+	}
 	return nil
 }
 
+// runCatchUp runs all jobs which missed a run while rsched was not running
+// one after the other.
+func (s *Scheduler) runCatchUp() {
+	for _, job := range s.catchUp {
+		_ = job() // Errors are logged by the job itself.
+	}
+}
+
 func (s *Scheduler) init() {
 	s.once.Do(func() {
 		s.shutdown = make(chan struct{})
+		s.done = make(chan struct{})
 		// Initialize the semaphore with 1 as we do not want to have more than
 		// one job running at any time.
 		s.sempaphore = make(chan struct{}, 1)
 		s.cron = cron.New()
+		s.active = make(map[*runState]struct{})
+		s.repoLocks = make(map[string]chan struct{})
+		s.lastBackups = make(map[string]time.Time)
 
 		if s.BackupFunc == nil {
 			s.BackupFunc = Backup
 		}
+		if s.ForgetFunc == nil {
+			s.ForgetFunc = Forget
+		}
+		if s.PruneFunc == nil {
+			s.PruneFunc = Prune
+		}
+		if s.CheckFunc == nil {
+			s.CheckFunc = Check
+		}
+		if s.RestoreDrillFunc == nil {
+			s.RestoreDrillFunc = RestoreDrill
+		}
 	})
 }
 
@@ -125,20 +554,366 @@ func (s *Scheduler) notifyShutdown(ctx context.Context) (context.Context, contex
 	return ctx, cancel
 }
 
+// jobInfo identifies a job registered with the Scheduler.
+type jobInfo struct {
+	Name    string
+	Kind    string
+	Retry   RetryPolicy
+	Timeout time.Duration
+	Overlap OverlapPolicy
+
+	// StartDelay delays the start of each run of the job.
+	StartDelay StartDelay
+
+	// Windows restricts when the job may run. Recurring windows are
+	// evaluated in Location, which is set by Scheduler.scheduleFunc.
+	Windows  Windows
+	Location *time.Location
+
+	// TimeZone is the name of the time zone the schedule of the job is
+	// evaluated in. Empty for the local time zone.
+	TimeZone string
+
+	// Repository identifies the repository the job operates on. It is used
+	// to prevent concurrent jobs from accessing the same repository.
+	Repository string
+}
+
+// newJobInfo creates the jobInfo of a job of the passed kind. The name,
+// retry policy, timeout, overlap policy, time zone, start delay, windows,
+// and repository of the job are taken from os.
+func newJobInfo(kind string, os []Option) jobInfo {
+	var opts options
+
+	opts.apply(os)
+	repo := opts.Env[EnvResticRepository]
+	if repo == "" && opts.Env[EnvResticRepositoryFile] != "" {
+		repo = "file:" + opts.Env[EnvResticRepositoryFile]
+	}
+	return jobInfo{
+		Name:       opts.JobName,
+		Kind:       kind,
+		Retry:      opts.Retry,
+		Timeout:    opts.Timeout,
+		Overlap:    opts.Overlap,
+		TimeZone:   opts.TimeZone,
+		StartDelay: opts.StartDelay,
+		Windows:    opts.Windows,
+		Repository: repo,
+	}
+}
+
 // newJob wraps a function f to be notified of scheduler shutdown and
-// acquire and release the semaphore.
-func (s *Scheduler) newJob(f func(context.Context)) func() {
-	return func() {
-		ctx, cancel := s.notifyShutdown(context.Background())
+// acquire and release the locks required by the job. Any error returned by
+// f is logged and returned by the wrapper.
+//
+// If the job becomes due while its previous run is still in progress
+// info.Overlap decides whether the run is skipped or queued. Skipped runs
+// are logged, recorded in s.Metrics, and return nil.
+//
+// Each run is delayed according to info.StartDelay before it waits for its
+// locks. The planned start is logged and recorded in s.Metrics.
+//
+// Runs are skipped or deferred if info.Windows does not allow the job to
+// run at the time the locks are acquired. Runs still in progress once the
+// allowed window ends or a blocked window starts are interrupted. Their
+// error wraps ErrWindowClosed.
+//
+// Each run of the job gets its own ID. The context passed to f carries a
+// logger adding the name of the job and the run ID to every log entry.
+//
+// Each attempt to run f is canceled if it takes longer than info.Timeout.
+// If f fails with a transient error it is retried according to info.Retry.
+// The locks are released while waiting for the next attempt, which allows
+// other jobs to run in the meantime.
+//
+// The result of each run is recorded in s.Metrics and s.State. If sched is
+// not nil it is used to record the time of the next run.
+func (s *Scheduler) newJob(info jobInfo, sched cron.Schedule, f func(context.Context) error) func() error {
+	var (
+		mu      sync.Mutex
+		pending int
+	)
+
+	return func() error {
+		mu.Lock()
+		if pending >= info.Overlap.maxPending() {
+			mu.Unlock()
+			slog.Warn(
+				"Skipping run, previous run still in progress",
+				"job", info.Name,
+				"kind", info.Kind,
+				"overlap_policy", info.Overlap,
+			)
+			s.Metrics.observeSkippedRun(info, "overlap")
+			if sched != nil {
+				s.Metrics.observeNextRun(info, sched.Next(time.Now()))
+			}
+			return nil
+		}
+		pending++
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			pending--
+			mu.Unlock()
+		}()
+
+		rs := &runState{info: info, runID: newRunID()}
+		log := slog.Default().With("job", info.Name, "kind", info.Kind, "run_id", rs.runID)
+		ctx, cancel := s.notifyShutdown(withRunState(withLogger(context.Background(), log), rs))
 		defer cancel()
 
-		if !s.acquireSemaphore(ctx) {
-			return
+		if !s.waitStartDelay(ctx, info) {
+			return ctx.Err()
+		}
+		if !s.acquireInWindow(ctx, rs) {
+			if sched != nil {
+				s.Metrics.observeNextRun(info, sched.Next(time.Now()))
+			}
+			return ctx.Err()
+		}
+
+		log.Info("Beginning job")
+		start := time.Now()
+		rs.start = start
+		if sErr := s.State.recordStart(info, start); sErr != nil {
+			log.Warn("Failed to save state", "error", sErr)
+		}
+		err := s.runInWindow(ctx, rs, f)
+		duration := time.Since(start)
+		s.Metrics.observeRun(info, start, duration, err)
+		if sErr := s.State.recordResult(info, start.Add(duration), err); sErr != nil {
+			log.Warn("Failed to save state", "error", sErr)
+		}
+		if sched != nil {
+			s.Metrics.observeNextRun(info, sched.Next(time.Now()))
+		}
+		if err != nil {
+			log.Error("Job failed", "duration", duration, "error", err, "error_class", ErrorClass(err))
+			return err
+		}
+		log.Info("Job completed", "duration", duration)
+		return nil
+	}
+}
+
+// waitStartDelay waits for the start delay of the job described by info.
+// It returns false if ctx is done before the delay expired.
+func (s *Scheduler) waitStartDelay(ctx context.Context, info jobInfo) bool {
+	delay := info.StartDelay.delay(info.Name, rand.Float64) // nolint: gosec
+	planned := time.Now().Add(delay)
+	s.Metrics.observePlannedStart(info, planned)
+	if delay <= 0 {
+		return true
+	}
+
+	logger(ctx).Info("Delaying job start", "delay", delay, "planned_start", planned)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// acquireInWindow acquires the locks of rs like acquire. Additionally it
+// makes sure the job is allowed to run by its windows once the locks are
+// acquired. If the job is not allowed to run the run is either skipped or
+// deferred until the job may run.
+//
+// acquireInWindow returns false if the run is skipped or ctx is done. No
+// locks are held in this case.
+func (s *Scheduler) acquireInWindow(ctx context.Context, rs *runState) bool {
+	info := rs.info
+	for {
+		if !s.acquire(ctx, rs) {
+			return false
+		}
+		now := time.Now()
+		next, ok := info.Windows.nextAllowed(now, info.Location)
+		if ok && !next.After(now) {
+			return true
+		}
+		s.release(rs)
+
+		if !ok || !info.Windows.Defer {
+			logger(ctx).Warn("Skipping run, blocked by window")
+			s.Metrics.observeSkippedRun(info, "window")
+			return false
+		}
+		logger(ctx).Info("Deferring run until window opens", "planned_start", next)
+		s.Metrics.observePlannedStart(info, next)
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return false
+		}
+	}
+}
+
+// runInWindow calls runAttempts with a context which is canceled once the
+// windows of the job no longer allow it to run. If the run fails afterwards
+// the returned error wraps ErrWindowClosed.
+func (s *Scheduler) runInWindow(ctx context.Context, rs *runState, f func(context.Context) error) error {
+	deadline, ok := rs.info.Windows.deadline(time.Now(), rs.info.Location)
+	if !ok {
+		return s.runAttempts(ctx, rs, f)
+	}
+
+	logger(ctx).Debug("Run must complete before window closes", "deadline", deadline)
+	wctx, cancel := context.WithDeadlineCause(
+		ctx, deadline, fmt.Errorf("%w at %s", ErrWindowClosed, deadline.Format(time.RFC3339)),
+	)
+	defer cancel()
+
+	err := s.runAttempts(wctx, rs, f)
+	if err != nil && ctx.Err() == nil && errors.Is(context.Cause(wctx), ErrWindowClosed) {
+		return fmt.Errorf("%w: %w", context.Cause(wctx), err)
+	}
+	return err
+}
+
+// runAttempts calls f using retryAttempts.
+//
+// runAttempts expects the locks of rs to be acquired by the caller. It
+// releases them after every attempt and acquires them again before the
+// next attempt. It always returns with the locks released.
+func (s *Scheduler) runAttempts(ctx context.Context, rs *runState, f func(context.Context) error) error {
+	return s.retryAttempts(
+		ctx, rs.info, f,
+		func() { s.release(rs) },
+		func(ctx context.Context) bool { return s.acquire(ctx, rs) },
+	)
+}
+
+// retryAttempts calls f until it succeeds, fails with an error which is
+// not transient, or the maximum number of attempts defined by info.Retry is
+// reached. Each attempt is canceled if it takes longer than info.Timeout.
+// It returns the error of the last attempt.
+//
+// release is called after every attempt. reacquire is called after waiting
+// for the backoff, before the next attempt. retryAttempts gives up if
+// reacquire returns false. Both may be nil.
+func (s *Scheduler) retryAttempts(
+	ctx context.Context,
+	info jobInfo,
+	f func(context.Context) error,
+	release func(),
+	reacquire func(context.Context) bool,
+) error {
+	log := logger(ctx)
+	for attempt := 1; ; attempt++ {
+		actx := withLogger(ctx, log.With("attempt", attempt))
+		setPhase(actx, "starting")
+		err := runWithTimeout(actx, info.Timeout, f)
+		if release != nil {
+			release()
+		}
+		s.Metrics.observeAttempt(info, err)
+
+		if err == nil || attempt >= info.Retry.MaxAttempts || !IsTransient(err) || ctx.Err() != nil {
+			return err
+		}
+		delay := info.Retry.backoff(attempt, rand.Float64) // nolint: gosec
+		logger(actx).Warn("Attempt failed, retrying", "error", err, "error_class", ErrorClass(err), "backoff", delay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+		if reacquire != nil && !reacquire(ctx) {
+			return err
+		}
+		log.Info("Retrying", "attempt", attempt+1)
+	}
+}
+
+// runWithTimeout calls f with a context which is canceled after timeout.
+// If f fails after the timeout expired the returned error wraps ErrTimeout.
+// A timeout of zero disables it.
+func runWithTimeout(ctx context.Context, timeout time.Duration, f func(context.Context) error) error {
+	if timeout <= 0 {
+		return f(ctx)
+	}
+
+	tctx, cancel := context.WithTimeoutCause(ctx, timeout, fmt.Errorf("%w after %s", ErrTimeout, timeout))
+	defer cancel()
+
+	err := f(tctx)
+	if err != nil && ctx.Err() == nil && errors.Is(context.Cause(tctx), ErrTimeout) {
+		return fmt.Errorf("%w: %w", context.Cause(tctx), err)
+	}
+	return err
+}
+
+// acquire acquires the locks required by the run rs and marks it as
+// active. Runs of jobs with OverlapConcurrent only acquire the lock of their
+// repository. All other runs additionally acquire the semaphore.
+//
+// acquire returns false if ctx is done before all locks are acquired or
+// the Scheduler is shut down. No locks are held in this case.
+func (s *Scheduler) acquire(ctx context.Context, rs *runState) bool {
+	concurrent := rs.info.Overlap == OverlapConcurrent
+	if !concurrent && !s.acquireSemaphore(ctx) {
+		return false
+	}
+	repoLock := s.repoLock(rs.info.Repository)
+	select {
+	case repoLock <- struct{}{}:
+	case <-ctx.Done():
+		if !concurrent {
+			s.releaseSempaphore()
 		}
-		defer s.releaseSempaphore()
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.shutdown:
+		<-repoLock
+		if !concurrent {
+			s.releaseSempaphore()
+		}
+		return false
+	default:
+	}
+	s.active[rs] = struct{}{}
+	return true
+}
+
+// release releases all locks acquired by acquire for rs.
+func (s *Scheduler) release(rs *runState) {
+	s.mu.Lock()
+	delete(s.active, rs)
+	if len(s.active) == 0 && s.drained != nil {
+		close(s.drained)
+		s.drained = nil
+	}
+	s.mu.Unlock()
+
+	<-s.repoLock(rs.info.Repository)
+	if rs.info.Overlap != OverlapConcurrent {
+		s.releaseSempaphore()
+	}
+}
+
+// repoLock returns the lock of the passed repository.
+func (s *Scheduler) repoLock(repo string) chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-		f(ctx)
+	l, ok := s.repoLocks[repo]
+	if !ok {
+		l = make(chan struct{}, 1)
+		s.repoLocks[repo] = l
 	}
+	return l
 }
 
 func (s *Scheduler) acquireSemaphore(ctx context.Context) bool {
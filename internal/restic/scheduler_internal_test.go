@@ -0,0 +1,81 @@
+package restic
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSchedule(t *testing.T) {
+	now := time.Date(2023, 5, 10, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		schedule  string
+		tz        string
+		next      time.Time
+		assertErr assert.ErrorAssertionFunc
+	}{
+		{
+			name:     "standard cron expression",
+			schedule: "0 3 * * *",
+			tz:       "UTC",
+			next:     time.Date(2023, 5, 10, 3, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "seconds field",
+			schedule: "30 0 3 * * *",
+			tz:       "UTC",
+			next:     time.Date(2023, 5, 10, 3, 0, 30, 0, time.UTC),
+		},
+		{
+			name:     "time zone",
+			schedule: "0 3 * * *",
+			tz:       "Asia/Tokyo",
+			next:     time.Date(2023, 5, 10, 18, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "descriptor in time zone",
+			schedule: "@daily",
+			tz:       "Asia/Tokyo",
+			next:     time.Date(2023, 5, 10, 15, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "CRON_TZ prefix takes precedence",
+			schedule: "CRON_TZ=America/New_York 0 3 * * *",
+			tz:       "Asia/Tokyo",
+			next:     time.Date(2023, 5, 10, 7, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "invalid time zone",
+			schedule:  "0 3 * * *",
+			tz:        "Mars/Olympus_Mons",
+			assertErr: assert.Error,
+		},
+		{
+			name:      "invalid CRON_TZ prefix",
+			schedule:  "CRON_TZ=Mars/Olympus_Mons 0 3 * * *",
+			assertErr: assert.Error,
+		},
+		{
+			name:      "invalid cron expression",
+			schedule:  "0 3 * *",
+			assertErr: assert.Error,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			sched, err := parseSchedule(tt.schedule, tt.tz)
+			if tt.assertErr != nil {
+				tt.assertErr(t, err)
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.True(t, tt.next.Equal(sched.Next(now)), "Expected next run at %v; got %v", tt.next, sched.Next(now))
+		})
+	}
+}
@@ -2,80 +2,234 @@ package restic_test
 
 import (
 	"context"
+	"fmt"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/fhofherr/rsched/internal/restic"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestScheduler_ScheduleBackup(t *testing.T) {
 	t.Run("schedule backup once", func(t *testing.T) {
-		called := make(chan struct{})
+		var calls int
 		s := &restic.Scheduler{
-			BackupFunc: func(ctx context.Context, path string, os ...restic.Option) error {
-				close(called)
+			BackupFunc: func(ctx context.Context, paths []string, os ...restic.Option) (restic.BackupSummary, error) {
+				calls++
+				return restic.BackupSummary{}, nil
+			},
+		}
+
+		err := s.ScheduleBackup(restic.ScheduleOnce, []string{"/some/path"})
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, 0, calls, "BackupFunc called before Run")
+		assert.NoError(t, s.Run())
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("schedule backup regularly", func(t *testing.T) {
+		s := &restic.Scheduler{
+			BackupFunc: func(ctx context.Context, paths []string, os ...restic.Option) (restic.BackupSummary, error) {
+				return restic.BackupSummary{}, nil
+			},
+		}
+		defer s.Shutdown()
+
+		err := s.ScheduleBackup("@hourly", []string{"/some/path"})
+		if !assert.NoError(t, err) {
+			return
+		}
+		restic.AssertSchedulerHasSingleJob(t, s)
+	})
+
+	t.Run("invalid cron schedule", func(t *testing.T) {
+		s := &restic.Scheduler{
+			BackupFunc: func(ctx context.Context, paths []string, os ...restic.Option) (restic.BackupSummary, error) {
+				return restic.BackupSummary{}, nil
+			},
+		}
+		defer s.Shutdown()
+
+		err := s.ScheduleBackup("invalid", []string{"/some/path"})
+		assert.Error(t, err)
+	})
+}
+
+func TestScheduler_ScheduleForget(t *testing.T) {
+	t.Run("schedule forget once", func(t *testing.T) {
+		var calls int
+		s := &restic.Scheduler{
+			ForgetFunc: func(ctx context.Context, os ...restic.Option) error {
+				calls++
+				return nil
+			},
+		}
+
+		err := s.ScheduleForget(restic.ScheduleOnce, restic.WithForgetPolicy(restic.ForgetPolicy{KeepLast: 1}))
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.NoError(t, s.Run())
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("schedule forget regularly", func(t *testing.T) {
+		s := &restic.Scheduler{
+			ForgetFunc: func(ctx context.Context, os ...restic.Option) error {
 				return nil
 			},
 		}
 		defer s.Shutdown()
 
-		err := s.ScheduleBackup(restic.ScheduleOnce, "/some/path")
+		err := s.ScheduleForget("@daily", restic.WithForgetPolicy(restic.ForgetPolicy{KeepLast: 1}))
 		if !assert.NoError(t, err) {
 			return
 		}
+		restic.AssertSchedulerHasSingleJob(t, s)
+	})
+}
+
+func TestScheduler_SchedulePrune(t *testing.T) {
+	t.Run("schedule prune regularly", func(t *testing.T) {
+		s := &restic.Scheduler{
+			PruneFunc: func(ctx context.Context, os ...restic.Option) error {
+				return nil
+			},
+		}
+		defer s.Shutdown()
+
+		err := s.SchedulePrune("@weekly", restic.WithMaxUnused("5%"))
+		if !assert.NoError(t, err) {
+			return
+		}
+		restic.AssertSchedulerHasSingleJob(t, s)
+	})
+
+	t.Run("prune and backup are serialized", func(t *testing.T) {
+		pruneDone := make(chan struct{})
+		backupDone := make(chan struct{})
+		pruneDly := 10 * time.Millisecond
+
+		s := &restic.Scheduler{
+			PruneFunc: func(ctx context.Context, os ...restic.Option) error {
+				<-time.After(pruneDly)
+				close(pruneDone)
+				return nil
+			},
+			BackupFunc: func(ctx context.Context, paths []string, os ...restic.Option) (restic.BackupSummary, error) {
+				select {
+				case <-pruneDone:
+				default:
+					t.Error("Backup started while prune was still running")
+				}
+				close(backupDone)
+				return restic.BackupSummary{}, nil
+			},
+		}
+
+		if err := s.SchedulePrune(restic.ScheduleOnce); !assert.NoError(t, err) {
+			return
+		}
+		if err := s.ScheduleBackup(restic.ScheduleOnce, []string{"/some/path"}); !assert.NoError(t, err) {
+			return
+		}
+		assert.NoError(t, s.Run())
+
 		select {
-		case <-called:
+		case <-backupDone:
 			return
-		case <-time.After(10 * time.Millisecond):
-			t.Error("BackupFunc not called within 10ms")
+		default:
+			t.Error("Backup not completed")
 		}
 	})
+}
+
+func TestScheduler_ScheduleCheck(t *testing.T) {
+	t.Run("check without reading data", func(t *testing.T) {
+		var calls int
 
-	t.Run("schedule backup regularly", func(t *testing.T) {
 		s := &restic.Scheduler{
-			BackupFunc: func(ctx context.Context, path string, os ...restic.Option) error {
+			CheckFunc: func(ctx context.Context, os ...restic.Option) error {
+				calls++
+				assert.Len(t, os, 1)
 				return nil
 			},
 		}
 		defer s.Shutdown()
 
-		err := s.ScheduleBackup("@hourly", "/some/path")
+		err := s.ScheduleCheck("@daily", 0, restic.WithRepository("/some/repo"))
 		if !assert.NoError(t, err) {
 			return
 		}
-		restic.AssertSchedulerHasSingleJob(t, s)
+		restic.RunScheduledJobs(t, s)
+		assert.Equal(t, 1, calls)
 	})
 
-	t.Run("invalid cron schedule", func(t *testing.T) {
+	t.Run("rotate through data subsets", func(t *testing.T) {
+		var actual []string
+
 		s := &restic.Scheduler{
-			BackupFunc: func(ctx context.Context, path string, os ...restic.Option) error {
+			CheckFunc: func(ctx context.Context, os ...restic.Option) error {
+				actual = append(actual, restic.ReadDataSubset(os...))
 				return nil
 			},
 		}
 		defer s.Shutdown()
 
-		err := s.ScheduleBackup("invalid", "/some/path")
-		assert.Error(t, err)
+		err := s.ScheduleCheck("@daily", 3, restic.WithReadDataSubset("ignored"))
+		if !assert.NoError(t, err) {
+			return
+		}
+		for i := 0; i < 4; i++ {
+			restic.RunScheduledJobs(t, s)
+		}
+		assert.Equal(t, []string{"1/3", "2/3", "3/3", "1/3"}, actual)
 	})
 }
 
+func TestScheduler_ScheduleRestoreDrill(t *testing.T) {
+	var calls int
+	s := &restic.Scheduler{
+		RestoreDrillFunc: func(ctx context.Context, os ...restic.Option) (restic.DrillReport, error) {
+			calls++
+			return restic.DrillReport{SnapshotID: "abcdef"}, nil
+		},
+	}
+
+	err := s.ScheduleRestoreDrill(restic.ScheduleOnce, restic.WithDrillSampleSize(10))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, s.Run())
+	assert.Equal(t, 1, calls)
+}
+
 func TestScheduler_Shutdown(t *testing.T) {
 	ready := make(chan struct{})
 	shutdownDly := 10 * time.Millisecond
 
 	s := &restic.Scheduler{
-		BackupFunc: func(ctx context.Context, path string, os ...restic.Option) error {
+		BackupFunc: func(ctx context.Context, paths []string, os ...restic.Option) (restic.BackupSummary, error) {
 			close(ready)
 			<-ctx.Done()
 			<-time.After(shutdownDly)
-			return ctx.Err()
+			return restic.BackupSummary{}, ctx.Err()
 		},
 	}
 
-	if err := s.ScheduleBackup(restic.ScheduleOnce, "/some/path"); !assert.NoError(t, err) {
+	if err := s.ScheduleBackup(restic.ScheduleOnce, []string{"/some/path"}); !assert.NoError(t, err) {
 		return
 	}
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- s.Run()
+	}()
 
 	select {
 	case <-ready:
@@ -89,4 +243,487 @@ func TestScheduler_Shutdown(t *testing.T) {
 	end := time.Now()
 
 	assert.GreaterOrEqual(t, end.Sub(start), shutdownDly)
+	assert.ErrorIs(t, <-runErr, context.Canceled)
+}
+
+func TestScheduler_Run(t *testing.T) {
+	t.Run("returns once all once jobs completed", func(t *testing.T) {
+		var kinds []string
+		s := &restic.Scheduler{
+			BackupFunc: func(ctx context.Context, paths []string, os ...restic.Option) (restic.BackupSummary, error) {
+				kinds = append(kinds, "backup")
+				return restic.BackupSummary{}, nil
+			},
+			ForgetFunc: func(ctx context.Context, os ...restic.Option) error {
+				kinds = append(kinds, "forget")
+				return nil
+			},
+		}
+
+		if err := s.ScheduleBackup(restic.ScheduleOnce, []string{"/some/path"}); !assert.NoError(t, err) {
+			return
+		}
+		if err := s.ScheduleForget(restic.ScheduleOnce); !assert.NoError(t, err) {
+			return
+		}
+		assert.NoError(t, s.Run())
+		assert.Equal(t, []string{"backup", "forget"}, kinds)
+		assert.False(t, s.Running())
+	})
+
+	t.Run("returns errors of all once jobs", func(t *testing.T) {
+		var forgetCalled bool
+		s := &restic.Scheduler{
+			BackupFunc: func(ctx context.Context, paths []string, os ...restic.Option) (restic.BackupSummary, error) {
+				return restic.BackupSummary{}, restic.Error{Command: "backup", ExitCode: 3}
+			},
+			ForgetFunc: func(ctx context.Context, os ...restic.Option) error {
+				forgetCalled = true
+				return nil
+			},
+		}
+
+		if err := s.ScheduleBackup(restic.ScheduleOnce, []string{"/some/path"}); !assert.NoError(t, err) {
+			return
+		}
+		if err := s.ScheduleForget(restic.ScheduleOnce); !assert.NoError(t, err) {
+			return
+		}
+		err := s.Run()
+		assert.ErrorIs(t, err, restic.ErrIncompleteBackup)
+		assert.True(t, forgetCalled, "Job after failed job not executed")
+	})
+}
+
+func TestScheduler_Retry(t *testing.T) {
+	policy := restic.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	tests := []struct {
+		name     string
+		results  []error
+		policy   restic.RetryPolicy
+		attempts int
+		err      error
+	}{
+		{
+			name:     "retry transient error",
+			results:  []error{restic.Error{Command: "backup", ExitCode: 11}, nil},
+			policy:   policy,
+			attempts: 2,
+		},
+		{
+			name: "give up after max attempts",
+			results: []error{
+				restic.Error{Command: "backup", Stderr: "Fatal: unable to open config file: dial tcp: i/o timeout"},
+				restic.Error{Command: "backup", ExitCode: 11},
+				restic.Error{Command: "backup", ExitCode: 11},
+			},
+			policy:   policy,
+			attempts: 3,
+			err:      restic.ErrRepoLocked,
+		},
+		{
+			name:     "do not retry permanent error",
+			results:  []error{restic.Error{Command: "backup", ExitCode: 12}},
+			policy:   policy,
+			attempts: 1,
+			err:      restic.ErrWrongPassword,
+		},
+		{
+			name:     "retries disabled",
+			results:  []error{restic.Error{Command: "backup", ExitCode: 11}},
+			attempts: 1,
+			err:      restic.ErrRepoLocked,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts int
+			s := &restic.Scheduler{
+				BackupFunc: func(
+					ctx context.Context, paths []string, os ...restic.Option,
+				) (restic.BackupSummary, error) {
+					err := tt.results[attempts]
+					attempts++
+					return restic.BackupSummary{}, err
+				},
+			}
+
+			err := s.ScheduleBackup(restic.ScheduleOnce, []string{"/some/path"}, restic.WithRetryPolicy(tt.policy))
+			if !assert.NoError(t, err) {
+				return
+			}
+			err = s.Run()
+			assert.Equal(t, tt.attempts, attempts)
+			if tt.err == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
+
+func TestScheduler_Retry_Shutdown(t *testing.T) {
+	var attempts int
+	failed := make(chan struct{})
+	s := &restic.Scheduler{
+		BackupFunc: func(ctx context.Context, paths []string, os ...restic.Option) (restic.BackupSummary, error) {
+			attempts++
+			close(failed)
+			return restic.BackupSummary{}, restic.Error{Command: "backup", ExitCode: 11}
+		},
+	}
+
+	policy := restic.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Hour}
+	err := s.ScheduleBackup(restic.ScheduleOnce, []string{"/some/path"}, restic.WithRetryPolicy(policy))
+	if !assert.NoError(t, err) {
+		return
+	}
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- s.Run()
+	}()
+
+	<-failed
+	s.Shutdown()
+	assert.ErrorIs(t, <-runErr, restic.ErrRepoLocked)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestScheduler_Timeout(t *testing.T) {
+	var attempts int
+	s := &restic.Scheduler{
+		BackupFunc: func(ctx context.Context, paths []string, os ...restic.Option) (restic.BackupSummary, error) {
+			attempts++
+			<-ctx.Done()
+			return restic.BackupSummary{}, restic.Error{Command: "backup", ExitCode: 130}
+		},
+	}
+
+	err := s.ScheduleBackup(
+		restic.ScheduleOnce,
+		[]string{"/some/path"},
+		restic.WithTimeout(10*time.Millisecond),
+		restic.WithRetryPolicy(restic.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}),
+	)
+	if !assert.NoError(t, err) {
+		return
+	}
+	err = s.Run()
+	assert.ErrorIs(t, err, restic.ErrTimeout)
+	assert.ErrorIs(t, err, restic.ErrInterrupted)
+	assert.Equal(t, "timeout", restic.ErrorClass(err))
+	assert.Equal(t, 1, attempts, "Timed out job retried")
+}
+
+func TestScheduler_Running(t *testing.T) {
+	s := &restic.Scheduler{
+		CheckFunc: func(ctx context.Context, os ...restic.Option) error {
+			return nil
+		},
+	}
+	assert.False(t, s.Running())
+	if err := s.ScheduleCheck("@daily", 0); !assert.NoError(t, err) {
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.Run()
+		close(done)
+	}()
+	assert.Eventually(t, s.Running, time.Second, time.Millisecond)
+
+	s.Shutdown()
+	assert.False(t, s.Running())
+	<-done
+}
+
+func TestScheduler_LastBackups(t *testing.T) {
+	var snapshotID string
+
+	s := &restic.Scheduler{
+		BackupFunc: func(ctx context.Context, paths []string, os ...restic.Option) (restic.BackupSummary, error) {
+			return restic.BackupSummary{SnapshotID: snapshotID}, nil
+		},
+	}
+	defer s.Shutdown()
+
+	err := s.ScheduleBackup("@hourly", []string{"/some/path"}, restic.WithJobName("test"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	last, ok := s.LastBackups()["test"]
+	assert.True(t, ok)
+	assert.True(t, last.IsZero())
+
+	// No snapshot created, no backup is recorded.
+	restic.RunScheduledJobs(t, s)
+	assert.True(t, s.LastBackups()["test"].IsZero())
+
+	before := time.Now()
+	snapshotID = "abcdef"
+	restic.RunScheduledJobs(t, s)
+	assert.False(t, s.LastBackups()["test"].Before(before))
+}
+
+func TestScheduler_Overlap(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   restic.OverlapPolicy
+		triggers int
+		skipped  int
+	}{
+		{
+			name:     "skip",
+			policy:   restic.OverlapSkip,
+			triggers: 2,
+			skipped:  2,
+		},
+		{
+			name:     "queue at most one run",
+			policy:   restic.OverlapQueue,
+			triggers: 3,
+			skipped:  2,
+		},
+		{
+			name:     "concurrent jobs queue at most one run",
+			policy:   restic.OverlapConcurrent,
+			triggers: 2,
+			skipped:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				mu   sync.Mutex
+				runs int
+			)
+			started := make(chan struct{}, tt.triggers+1)
+			release := make(chan struct{})
+			reg := prometheus.NewPedanticRegistry()
+			s := &restic.Scheduler{
+				BackupFunc: func(
+					ctx context.Context, paths []string, os ...restic.Option,
+				) (restic.BackupSummary, error) {
+					mu.Lock()
+					runs++
+					mu.Unlock()
+					started <- struct{}{}
+					<-release
+					return restic.BackupSummary{}, nil
+				},
+				Metrics: restic.NewMetrics(reg),
+			}
+			defer s.Shutdown()
+
+			err := s.ScheduleBackup(
+				"@hourly",
+				[]string{"/some/path"},
+				restic.WithJobName("test"),
+				restic.WithOverlapPolicy(tt.policy),
+			)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			returned := make(chan struct{}, tt.triggers+1)
+			trigger := func() {
+				restic.RunScheduledJobs(t, s)
+				returned <- struct{}{}
+			}
+			go trigger()
+			<-started
+			for i := 0; i < tt.triggers; i++ {
+				go trigger()
+			}
+			// Skipped runs return while the first run is still in progress.
+			for i := 0; i < tt.skipped; i++ {
+				<-returned
+			}
+			close(release)
+			for i := 0; i < tt.triggers+1-tt.skipped; i++ {
+				<-returned
+			}
+
+			assert.Equal(t, tt.triggers+1-tt.skipped, runs)
+			expected := fmt.Sprintf(`
+# HELP rsched_job_skipped_runs_total Total number of skipped runs of the job by reason.
+# TYPE rsched_job_skipped_runs_total counter
+rsched_job_skipped_runs_total{job="test",kind="backup",reason="overlap"} %d
+`, tt.skipped)
+			err = testutil.GatherAndCompare(reg, strings.NewReader(expected), "rsched_job_skipped_runs_total")
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestScheduler_Overlap_Repositories(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     restic.OverlapPolicy
+		repos      []string
+		concurrent bool
+	}{
+		{
+			name:       "concurrent jobs with different repositories",
+			policy:     restic.OverlapConcurrent,
+			repos:      []string{"/repo/a", "/repo/b"},
+			concurrent: true,
+		},
+		{
+			name:   "concurrent jobs with the same repository",
+			policy: restic.OverlapConcurrent,
+			repos:  []string{"/repo/a", "/repo/a"},
+		},
+		{
+			name:   "queued jobs with different repositories",
+			policy: restic.OverlapQueue,
+			repos:  []string{"/repo/a", "/repo/b"},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				mu       sync.Mutex
+				inFlight int
+				overlap  bool
+			)
+			both := make(chan struct{})
+			s := &restic.Scheduler{
+				BackupFunc: func(
+					ctx context.Context, paths []string, os ...restic.Option,
+				) (restic.BackupSummary, error) {
+					mu.Lock()
+					inFlight++
+					if inFlight == 2 {
+						overlap = true
+						close(both)
+					}
+					mu.Unlock()
+
+					select {
+					case <-both:
+					case <-time.After(100 * time.Millisecond):
+					}
+
+					mu.Lock()
+					inFlight--
+					mu.Unlock()
+					return restic.BackupSummary{}, nil
+				},
+			}
+			defer s.Shutdown()
+
+			for i, repo := range tt.repos {
+				err := s.ScheduleBackup(
+					"@hourly",
+					[]string{"/some/path"},
+					restic.WithJobName(fmt.Sprintf("job-%d", i)),
+					restic.WithRepository(repo),
+					restic.WithOverlapPolicy(tt.policy),
+				)
+				if !assert.NoError(t, err) {
+					return
+				}
+			}
+			restic.RunScheduledJobsConcurrently(t, s)
+			assert.Equal(t, tt.concurrent, overlap)
+		})
+	}
+}
+
+func TestScheduler_Windows(t *testing.T) {
+	blockedNow := restic.Window{From: time.Now().Add(-time.Hour), Until: time.Now().Add(time.Hour)}
+	tests := []struct {
+		name    string
+		windows func() restic.Windows
+		block   bool
+		called  bool
+		skipped int
+		err     error
+	}{
+		{
+			name: "skip run in blocked window",
+			windows: func() restic.Windows {
+				return restic.Windows{Blocked: restic.WindowList{blockedNow}}
+			},
+			skipped: 1,
+		},
+		{
+			name: "skip run outside of allowed window",
+			windows: func() restic.Windows {
+				allowed := restic.Window{From: time.Now().Add(time.Hour), Until: time.Now().Add(2 * time.Hour)}
+				return restic.Windows{Allowed: restic.WindowList{allowed}}
+			},
+			skipped: 1,
+		},
+		{
+			name: "defer run until blocked window ends",
+			windows: func() restic.Windows {
+				blocked := restic.Window{From: time.Now().Add(-time.Hour), Until: time.Now().Add(20 * time.Millisecond)}
+				return restic.Windows{Blocked: restic.WindowList{blocked}, Defer: true}
+			},
+			called: true,
+		},
+		{
+			name: "interrupt run once allowed window ends",
+			windows: func() restic.Windows {
+				allowed := restic.Window{From: time.Now().Add(-time.Hour), Until: time.Now().Add(20 * time.Millisecond)}
+				return restic.Windows{Allowed: restic.WindowList{allowed}}
+			},
+			block:  true,
+			called: true,
+			err:    restic.ErrWindowClosed,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var called bool
+			reg := prometheus.NewPedanticRegistry()
+			s := &restic.Scheduler{
+				BackupFunc: func(
+					ctx context.Context, paths []string, os ...restic.Option,
+				) (restic.BackupSummary, error) {
+					called = true
+					if tt.block {
+						<-ctx.Done()
+						return restic.BackupSummary{}, restic.Error{Command: "backup", ExitCode: 130}
+					}
+					return restic.BackupSummary{}, nil
+				},
+				Metrics: restic.NewMetrics(reg),
+			}
+
+			err := s.ScheduleBackup(
+				restic.ScheduleOnce,
+				[]string{"/some/path"},
+				restic.WithJobName("test"),
+				restic.WithWindows(tt.windows()),
+			)
+			if !assert.NoError(t, err) {
+				return
+			}
+			err = s.Run()
+			assert.Equal(t, tt.called, called)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				assert.Equal(t, "window_closed", restic.ErrorClass(err))
+			} else {
+				assert.NoError(t, err)
+			}
+
+			n, err := testutil.GatherAndCount(reg, "rsched_job_skipped_runs_total")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.skipped, n)
+		})
+	}
 }
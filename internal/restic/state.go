@@ -0,0 +1,168 @@
+package restic
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// ResultSuccess is the result recorded in JobState if the last run of a job
+// succeeded. Otherwise the result is the class of the error the run failed
+// with, see ErrorClass.
+const ResultSuccess = "success"
+
+// JobState contains the state of a job persisted between restarts of
+// rsched.
+type JobState struct {
+	LastStart   time.Time `json:"last_start"`
+	LastSuccess time.Time `json:"last_success"`
+	LastResult  string    `json:"last_result"`
+
+	// LastSubset is the data subset last checked successfully by a check
+	// job. See Scheduler.ScheduleCheck.
+	LastSubset int `json:"last_subset,omitempty"`
+}
+
+// State keeps track of the runs of all jobs and persists them to a file.
+// This allows Scheduler to catch up on runs missed while rsched was not
+// running.
+//
+// A nil *State is valid and records nothing.
+type State struct {
+	path string
+
+	mu   sync.Mutex
+	jobs map[string]map[string]JobState
+}
+
+// LoadState loads the State persisted in the file at path. The file does
+// not need to exist. It is created once the first job starts.
+func LoadState(path string) (*State, error) {
+	s := &State{path: path, jobs: make(map[string]map[string]JobState)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load state: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.jobs); err != nil {
+		return nil, fmt.Errorf("load state %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Job returns the state of the job called name for operations of the passed
+// kind, e.g. backup. The second return value is false if no run of the job
+// was recorded yet.
+func (s *State) Job(name, kind string) (JobState, bool) {
+	if s == nil {
+		return JobState{}, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	js, ok := s.jobs[name][kind]
+	return js, ok
+}
+
+// recordStart records the start of a run of the job described by info and
+// persists the state.
+func (s *State) recordStart(info jobInfo, start time.Time) error {
+	return s.update(info, func(js *JobState) {
+		js.LastStart = start
+	})
+}
+
+// recordResult records the result of a run of the job described by info and
+// persists the state.
+func (s *State) recordResult(info jobInfo, end time.Time, err error) error {
+	return s.update(info, func(js *JobState) {
+		if err != nil {
+			js.LastResult = ErrorClass(err)
+			return
+		}
+		js.LastSuccess = end
+		js.LastResult = ResultSuccess
+	})
+}
+
+// recordSubset records the data subset last checked successfully by the
+// job described by info and persists the state.
+func (s *State) recordSubset(info jobInfo, subset int) error {
+	return s.update(info, func(js *JobState) {
+		js.LastSubset = subset
+	})
+}
+
+func (s *State) update(info jobInfo, f func(*JobState)) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.jobs[info.Name] == nil {
+		s.jobs[info.Name] = make(map[string]JobState)
+	}
+	js := s.jobs[info.Name][info.Kind]
+	f(&js)
+	s.jobs[info.Name][info.Kind] = js
+	return s.save()
+}
+
+// save writes the state to a temporary file and renames it to s.path. This
+// ensures the file is never only partially written. The caller must hold
+// s.mu.
+func (s *State) save() error {
+	data, err := json.MarshalIndent(s.jobs, "", "  ")
+	if err != nil {
+		return fmt.Errorf("save state: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return fmt.Errorf("save state: %w", err)
+	}
+
+	_, err = tmp.Write(data)
+	if cErr := tmp.Close(); err == nil {
+		err = cErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("save state: %w", err)
+	}
+	return nil
+}
+
+// missedRun returns the earliest time sched should have run the job
+// described by info since its last success. Only runs within window before
+// now are considered. The second return value is false if no run was
+// missed, the state contains no run of the job, or window is zero.
+func (s *State) missedRun(info jobInfo, sched cron.Schedule, now time.Time, window time.Duration) (time.Time, bool) {
+	js, ok := s.Job(info.Name, info.Kind)
+	if !ok || window <= 0 {
+		return time.Time{}, false
+	}
+
+	from := js.LastSuccess
+	if earliest := now.Add(-window); from.Before(earliest) {
+		from = earliest
+	}
+	missed := sched.Next(from)
+	if missed.IsZero() || missed.After(now) {
+		return time.Time{}, false
+	}
+	return missed, true
+}
@@ -0,0 +1,81 @@
+package restic
+
+import (
+	"testing"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestState_MissedRun(t *testing.T) {
+	now := time.Date(2023, 5, 10, 8, 0, 0, 0, time.Local)
+	info := jobInfo{Name: "test", Kind: "backup"}
+	tests := []struct {
+		name        string
+		lastSuccess time.Time
+		noState     bool
+		window      time.Duration
+		missed      time.Time
+		ok          bool
+	}{
+		{
+			name:        "no run missed",
+			lastSuccess: now.Add(-6 * time.Hour),
+			window:      48 * time.Hour,
+		},
+		{
+			name:        "run missed",
+			lastSuccess: now.Add(-30 * time.Hour),
+			window:      48 * time.Hour,
+			missed:      time.Date(2023, 5, 10, 2, 0, 0, 0, time.Local),
+			ok:          true,
+		},
+		{
+			name:        "earliest missed run within window",
+			lastSuccess: now.Add(-72 * time.Hour),
+			window:      48 * time.Hour,
+			missed:      time.Date(2023, 5, 9, 2, 0, 0, 0, time.Local),
+			ok:          true,
+		},
+		{
+			name:        "missed run outside of window",
+			lastSuccess: now.Add(-30 * time.Hour),
+			window:      5 * time.Hour,
+		},
+		{
+			name:        "never succeeded",
+			lastSuccess: time.Time{},
+			window:      24 * time.Hour,
+			missed:      time.Date(2023, 5, 10, 2, 0, 0, 0, time.Local),
+			ok:          true,
+		},
+		{
+			name:    "never run",
+			noState: true,
+			window:  24 * time.Hour,
+		},
+		{
+			name:        "catch up disabled",
+			lastSuccess: now.Add(-30 * time.Hour),
+		},
+	}
+
+	sched, err := cron.ParseStandard("0 2 * * *")
+	if !assert.NoError(t, err) {
+		return
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			s := &State{jobs: make(map[string]map[string]JobState)}
+			if !tt.noState {
+				s.jobs[info.Name] = map[string]JobState{info.Kind: {LastSuccess: tt.lastSuccess}}
+			}
+
+			missed, ok := s.missedRun(info, sched, now, tt.window)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.missed, missed)
+		})
+	}
+}
@@ -0,0 +1,239 @@
+package restic_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fhofherr/rsched/internal/restic"
+	"github.com/fhofherr/rsched/internal/testsupport"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestState(t *testing.T) {
+	path := filepath.Join(testsupport.TempDir(t), "state.json")
+	state, err := restic.LoadState(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, ok := state.Job("test", "backup")
+	assert.False(t, ok)
+
+	results := []error{nil, restic.Error{Command: "backup", ExitCode: 12}}
+	s := &restic.Scheduler{
+		BackupFunc: func(ctx context.Context, paths []string, os ...restic.Option) (restic.BackupSummary, error) {
+			err := results[0]
+			results = results[1:]
+			return restic.BackupSummary{}, err
+		},
+		State: state,
+	}
+	defer s.Shutdown()
+
+	err = s.ScheduleBackup("@hourly", []string{"/some/path"}, restic.WithJobName("test"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	before := time.Now()
+	restic.RunScheduledJobs(t, s)
+	restic.RunScheduledJobs(t, s)
+
+	// Load the state from the file again to ensure it was persisted.
+	state, err = restic.LoadState(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	js, ok := state.Job("test", "backup")
+	if !assert.True(t, ok) {
+		return
+	}
+	assert.Equal(t, "wrong_password", js.LastResult)
+	assert.False(t, js.LastSuccess.Before(before))
+	assert.False(t, js.LastStart.Before(js.LastSuccess))
+}
+
+func TestState_CheckSubsets(t *testing.T) {
+	path := filepath.Join(testsupport.TempDir(t), "state.json")
+	results := []error{nil, restic.Error{Command: "check", ExitCode: 1}, nil}
+
+	var actual []string
+	// Each iteration simulates a restart of rsched in single-shot mode.
+	for range results {
+		state, err := restic.LoadState(path)
+		if !assert.NoError(t, err) {
+			return
+		}
+		s := &restic.Scheduler{
+			CheckFunc: func(ctx context.Context, os ...restic.Option) error {
+				actual = append(actual, restic.ReadDataSubset(os...))
+				err := results[0]
+				results = results[1:]
+				return err
+			},
+			State: state,
+		}
+		err = s.ScheduleCheck(restic.ScheduleOnce, 3, restic.WithJobName("test"))
+		if !assert.NoError(t, err) {
+			return
+		}
+		_ = s.Run() // The second run fails.
+	}
+	// The failed subset is checked again.
+	assert.Equal(t, []string{"1/3", "2/3", "2/3"}, actual)
+}
+
+func TestLoadState_Invalid(t *testing.T) {
+	path := filepath.Join(testsupport.TempDir(t), "state.json")
+	if err := os.WriteFile(path, []byte("not json"), 0o600); !assert.NoError(t, err) {
+		return
+	}
+	_, err := restic.LoadState(path)
+	assert.Error(t, err)
+}
+
+func TestScheduler_CatchUp(t *testing.T) {
+	tests := []struct {
+		name        string
+		lastSuccess time.Duration
+		window      time.Duration
+		catchUp     bool
+	}{
+		{
+			name:        "catch up on missed run",
+			lastSuccess: 49 * time.Hour,
+			window:      72 * time.Hour,
+			catchUp:     true,
+		},
+		{
+			name:        "no run missed",
+			lastSuccess: time.Minute,
+			window:      72 * time.Hour,
+		},
+		{
+			name:        "catch up disabled",
+			lastSuccess: 49 * time.Hour,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(testsupport.TempDir(t), "state.json")
+			state, err := restic.LoadState(path)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			// Record a successful run in the past using a separate scheduler.
+			prev := &restic.Scheduler{
+				BackupFunc: func(
+					ctx context.Context, paths []string, os ...restic.Option,
+				) (restic.BackupSummary, error) {
+					return restic.BackupSummary{}, nil
+				},
+				State: state,
+			}
+			err = prev.ScheduleBackup(restic.ScheduleOnce, nil, restic.WithJobName("test"))
+			if !assert.NoError(t, err) {
+				return
+			}
+			if err := prev.Run(); !assert.NoError(t, err) {
+				return
+			}
+			setLastSuccess(t, path, time.Now().Add(-tt.lastSuccess))
+			state, err = restic.LoadState(path)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			ran := make(chan struct{}, 1)
+			s := &restic.Scheduler{
+				BackupFunc: func(
+					ctx context.Context, paths []string, os ...restic.Option,
+				) (restic.BackupSummary, error) {
+					ran <- struct{}{}
+					return restic.BackupSummary{}, nil
+				},
+				State:         state,
+				CatchUpWindow: tt.window,
+			}
+			if err := s.ScheduleBackup("@daily", nil, restic.WithJobName("test")); !assert.NoError(t, err) {
+				return
+			}
+			done := make(chan struct{})
+			go func() {
+				_ = s.Run()
+				close(done)
+			}()
+
+			select {
+			case <-ran:
+				assert.True(t, tt.catchUp, "Unexpected catch up")
+			case <-time.After(100 * time.Millisecond):
+				assert.False(t, tt.catchUp, "Missed run not caught up")
+			}
+			s.Shutdown()
+			<-done
+		})
+	}
+}
+
+// setLastSuccess changes the last success of all jobs in the state file at
+// path to t.
+func TestState_LastBackups(t *testing.T) {
+	path := filepath.Join(testsupport.TempDir(t), "state.json")
+	lastSuccess := time.Now().Add(-2 * time.Hour).UTC().Truncate(time.Second)
+	jobs := map[string]map[string]restic.JobState{
+		"test": {restic.KindBackup: {LastSuccess: lastSuccess, LastResult: restic.ResultSuccess}},
+	}
+	data, err := json.Marshal(jobs)
+	if !assert.NoError(t, err) {
+		return
+	}
+	if !assert.NoError(t, os.WriteFile(path, data, 0o600)) {
+		return
+	}
+	state, err := restic.LoadState(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	s := &restic.Scheduler{State: state}
+	defer s.Shutdown()
+	for _, name := range []string{"test", "other"} {
+		err := s.ScheduleBackup("@hourly", []string{"/some/path"}, restic.WithJobName(name))
+		if !assert.NoError(t, err) {
+			return
+		}
+	}
+	assert.True(t, lastSuccess.Equal(s.LastBackups()["test"]))
+	assert.True(t, s.LastBackups()["other"].IsZero())
+}
+
+func setLastSuccess(t *testing.T, path string, lastSuccess time.Time) {
+	t.Helper()
+
+	state, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var jobs map[string]map[string]restic.JobState
+	if err := json.Unmarshal(state, &jobs); err != nil {
+		t.Fatal(err)
+	}
+	for _, kinds := range jobs {
+		for kind, js := range kinds {
+			js.LastSuccess = lastSuccess
+			kinds[kind] = js
+		}
+	}
+	if state, err = json.Marshal(jobs); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, state, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,92 @@
+package restic
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+)
+
+// maxStderrSize is the maximum number of bytes of restic's stderr kept for
+// Error.Stderr.
+const maxStderrSize = 64 * 1024
+
+// maxLineSize is the maximum length of a line logged by lineLogger. Longer
+// lines are split.
+const maxLineSize = 16 * 1024
+
+// lineLogger is an io.Writer which logs every line written to it.
+//
+// Both \n and \r are treated as line endings, as restic uses \r to update
+// its progress output. Empty lines are not logged. Flush needs to be called
+// once writing is done to log any incomplete last line.
+type lineLogger struct {
+	log   *slog.Logger
+	level slog.Level
+	buf   []byte
+}
+
+func newLineLogger(log *slog.Logger, level slog.Level, stream string) *lineLogger {
+	return &lineLogger{
+		log:   log.With("stream", stream),
+		level: level,
+	}
+}
+
+func (l *lineLogger) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexAny(p, "\r\n")
+		if i < 0 {
+			l.buf = append(l.buf, p...)
+			if len(l.buf) >= maxLineSize {
+				l.Flush()
+			}
+			break
+		}
+		l.buf = append(l.buf, p[:i]...)
+		l.Flush()
+		p = p[i+1:]
+	}
+	return n, nil
+}
+
+// Flush logs any incomplete line.
+func (l *lineLogger) Flush() {
+	if len(l.buf) == 0 {
+		return
+	}
+	l.log.Log(context.Background(), l.level, string(l.buf))
+	l.buf = l.buf[:0]
+}
+
+// tailBuffer is an io.Writer which keeps only the last max bytes written to
+// it.
+type tailBuffer struct {
+	max       int
+	buf       []byte
+	truncated bool
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.buf = append(b.buf, p...)
+	// Only drop data once twice the allowed size is reached, to avoid
+	// copying the buffer on every write.
+	if len(b.buf) > 2*b.max {
+		b.buf = append(b.buf[:0], b.buf[len(b.buf)-b.max:]...)
+		b.truncated = true
+	}
+	return len(p), nil
+}
+
+// String returns the last max bytes written to b. If earlier bytes were
+// dropped the result starts with a marker.
+func (b *tailBuffer) String() string {
+	s, truncated := b.buf, b.truncated
+	if len(s) > b.max {
+		s, truncated = s[len(s)-b.max:], true
+	}
+	if truncated {
+		return "[truncated] " + string(s)
+	}
+	return string(s)
+}
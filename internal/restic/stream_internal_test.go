@@ -0,0 +1,70 @@
+package restic
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLineLogger(t *testing.T) {
+	var buf bytes.Buffer
+
+	log := slog.New(slog.NewJSONHandler(&buf, nil))
+	l := newLineLogger(log, slog.LevelWarn, "stderr")
+
+	for _, s := range []string{"first ", "line\nsecond line\r", "\n", "third", " line"} {
+		n, err := io.WriteString(l, s)
+		assert.NoError(t, err)
+		assert.Equal(t, len(s), n)
+	}
+	l.Flush()
+
+	var msgs []string
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var entry map[string]interface{}
+
+		if !assert.NoError(t, dec.Decode(&entry)) {
+			return
+		}
+		assert.Equal(t, "WARN", entry["level"])
+		assert.Equal(t, "stderr", entry["stream"])
+		msgs = append(msgs, entry["msg"].(string))
+	}
+	assert.Equal(t, []string{"first line", "second line", "third line"}, msgs)
+}
+
+func TestLineLogger_LongLine(t *testing.T) {
+	var buf bytes.Buffer
+
+	log := slog.New(slog.NewTextHandler(&buf, nil))
+	l := newLineLogger(log, slog.LevelInfo, "stdout")
+
+	_, err := io.WriteString(l, strings.Repeat("a", maxLineSize+1))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(buf.String(), "\n"), "long line not logged before flush")
+	l.Flush()
+	assert.Empty(t, l.buf)
+}
+
+func TestTailBuffer(t *testing.T) {
+	b := &tailBuffer{max: 4}
+
+	_, err := io.WriteString(b, "abc")
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", b.String())
+
+	_, err = io.WriteString(b, "def")
+	assert.NoError(t, err)
+	assert.Equal(t, "[truncated] cdef", b.String())
+
+	_, err = io.WriteString(b, "ghijk")
+	assert.NoError(t, err)
+	assert.Equal(t, "[truncated] hijk", b.String())
+	assert.LessOrEqual(t, len(b.buf), 2*b.max)
+}
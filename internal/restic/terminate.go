@@ -0,0 +1,128 @@
+package restic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultKillGracePeriod is the time restic gets to exit after it was
+// interrupted if no other grace period is configured.
+const DefaultKillGracePeriod = 30 * time.Second
+
+// termination takes care of stopping a command and all its child processes
+// once the context of the command is canceled.
+//
+// The command is started in its own process group. Once its context is
+// canceled SIGINT is sent to the whole group. This allows restic to remove
+// its locks from the repository. If the command does not exit within the
+// grace period all processes in the group are killed.
+type termination struct {
+	cmd   *exec.Cmd
+	log   *slog.Logger
+	name  string
+	grace time.Duration
+
+	mu          sync.Mutex
+	interrupted time.Time
+	killed      bool
+}
+
+// interrupted contains the terminations of all commands which were
+// interrupted but did not complete yet.
+var interrupted = struct {
+	sync.Mutex
+	m map[*termination]struct{}
+}{m: make(map[*termination]struct{})}
+
+// killInterrupted kills all commands which were interrupted but did not
+// complete yet, together with their child processes.
+func killInterrupted() {
+	interrupted.Lock()
+	defer interrupted.Unlock()
+
+	for t := range interrupted.m {
+		t.mu.Lock()
+		t.killed = true
+		t.mu.Unlock()
+		if err := signalGroup(t.cmd.Process, syscall.SIGKILL); err != nil && !errors.Is(err, syscall.ESRCH) {
+			t.log.Warn("Failed to kill "+t.name, "error", err)
+		}
+	}
+}
+
+// newTermination configures cmd to be terminated gracefully. It must be
+// called before cmd is started. cmd must have been created using
+// exec.CommandContext. name describes cmd in log messages, e.g. restic.
+func newTermination(
+	ctx context.Context, cmd *exec.Cmd, log *slog.Logger, name string, grace time.Duration,
+) *termination {
+	if grace <= 0 {
+		grace = DefaultKillGracePeriod
+	}
+	t := &termination{cmd: cmd, log: log, name: name, grace: grace}
+
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error {
+		t.mu.Lock()
+		t.interrupted = time.Now()
+		t.mu.Unlock()
+
+		interrupted.Lock()
+		interrupted.m[t] = struct{}{}
+		interrupted.Unlock()
+
+		log.Warn("Interrupting "+name, "reason", context.Cause(ctx), "grace_period", grace)
+		return signalGroup(cmd.Process, syscall.SIGINT)
+	}
+	cmd.WaitDelay = grace
+	return t
+}
+
+// done must be called once cmd completed with err. It kills any processes
+// left over in the process group of cmd.
+//
+// If cmd was interrupted done logs whether it exited on its own. If it had
+// to be killed, either because the grace period expired or killInterrupted
+// was called, the returned error wraps ErrKilled and err.
+// Otherwise err is returned unchanged.
+func (t *termination) done(err error) error {
+	interrupted.Lock()
+	delete(interrupted.m, t)
+	interrupted.Unlock()
+
+	if t.cmd.Process != nil {
+		if kErr := signalGroup(t.cmd.Process, syscall.SIGKILL); kErr != nil && !errors.Is(kErr, syscall.ESRCH) {
+			t.log.Warn("Failed to kill remaining processes", "error", kErr)
+		}
+	}
+
+	t.mu.Lock()
+	interrupted, killed := t.interrupted, t.killed
+	t.mu.Unlock()
+	if interrupted.IsZero() {
+		return err
+	}
+
+	elapsed := time.Since(interrupted)
+	if !killed && elapsed < t.grace {
+		t.log.Info(t.title()+" exited after interrupt", "clean", true, "elapsed", elapsed)
+		return err
+	}
+	t.log.Error(t.title()+" killed", "clean", false, "elapsed", elapsed, "grace_period", t.grace)
+	return fmt.Errorf("%w after %s: %w", ErrKilled, elapsed.Round(time.Millisecond), err)
+}
+
+// title returns t.name starting with an upper case letter.
+func (t *termination) title() string {
+	if t.name == "" {
+		return ""
+	}
+	return strings.ToUpper(t.name[:1]) + t.name[1:]
+}
@@ -0,0 +1,85 @@
+//go:build linux
+
+package restic
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunResticOutput_KillAfterGracePeriod(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	pidFile := filepath.Join(t.TempDir(), "child.pid")
+	var opts options
+	opts.apply([]Option{WithBinary("/bin/sh"), WithKillGracePeriod(100 * time.Millisecond)})
+
+	// The shell and its child ignore SIGINT, which forces rsched to kill
+	// them.
+	script := fmt.Sprintf("trap '' INT; sleep 10 >/dev/null 2>&1 & echo $! > %s; wait", pidFile)
+	start := time.Now()
+	err := runResticOutput(ctx, opts, nil, "-c", script)
+	assert.ErrorIs(t, err, ErrKilled)
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	data, err := os.ReadFile(pidFile)
+	if !assert.NoError(t, err) {
+		return
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Eventually(t, func() bool {
+		return processGone(pid)
+	}, time.Second, 10*time.Millisecond, "Child process %d still running", pid)
+}
+
+// processGone returns true if the process with the passed pid does not
+// exist or is a zombie.
+func processGone(pid int) bool {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return true
+	}
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	return len(fields) > 0 && fields[0] == "Z"
+}
+
+func TestKillInterrupted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var opts options
+	opts.apply([]Option{WithBinary("/bin/sh"), WithKillGracePeriod(time.Minute)})
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- runResticOutput(ctx, opts, nil, "-c", "trap '' INT; sleep 10 >/dev/null 2>&1 & wait")
+	}()
+	// Give the shell some time to set up the trap.
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	assert.Eventually(t, func() bool {
+		interrupted.Lock()
+		defer interrupted.Unlock()
+		return len(interrupted.m) > 0
+	}, time.Second, time.Millisecond)
+	killInterrupted()
+
+	select {
+	case err := <-errc:
+		assert.ErrorIs(t, err, ErrKilled)
+	case <-time.After(5 * time.Second):
+		t.Error("Restic not killed")
+	}
+}
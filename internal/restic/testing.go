@@ -2,19 +2,23 @@ package restic
 
 import (
 	"fmt"
+	"io"
 	"os/exec"
+	"sync"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/robfig/cron/v3"
 	"github.com/stretchr/testify/assert"
 )
 
 // TestCase represents a test case for a call to restic.
 type TestCase struct {
-	Name       string
-	Repo       string
-	Password   string
-	BackupPath string
+	Name        string
+	Repo        string
+	Password    string
+	BackupPaths []string
+	ScratchDir  string
 
 	// Put any additional options in here. The Run method makes sure this gets
 	// additionally filled with an WithRunner option pointing to a mock
@@ -47,6 +51,18 @@ type ExpectedInvocation struct {
 	Args []string
 	Env  map[string]string
 	Code int
+
+	// Stderr is written to the standard error of the invocation if set.
+	// Additionally it is returned as part of the Error if Code is greater
+	// than zero.
+	Stderr string
+
+	// Stdout is written to the standard output of the invocation if set.
+	Stdout string
+
+	// Effect is called after the invocation was matched if set. It allows to
+	// simulate side effects of restic, e.g. restoring files.
+	Effect func(t *testing.T, cmd *exec.Cmd)
 }
 
 // TestCmdRunner is a runner that converts the cmd passed to Run to an
@@ -74,12 +90,27 @@ func (r *TestCmdRunner) Run(cmd *exec.Cmd) error {
 	}
 
 	assert := assert.New(r.T)
-	assert.ElementsMatch(inv.Args, cmd.Args, "Arguments don't match")
+	assert.Equal(inv.Args, cmd.Args, "Arguments don't match")
 	assert.ElementsMatch(cmd.Env, expectedEnv, "Environment does not match")
 
+	if inv.Stdout != "" && cmd.Stdout != nil {
+		if _, err := io.WriteString(cmd.Stdout, inv.Stdout); err != nil {
+			r.T.Fatalf("Write stdout: %v", err)
+		}
+	}
+	if inv.Stderr != "" && cmd.Stderr != nil {
+		if _, err := io.WriteString(cmd.Stderr, inv.Stderr); err != nil {
+			r.T.Fatalf("Write stderr: %v", err)
+		}
+	}
+	if inv.Effect != nil {
+		inv.Effect(r.T, cmd)
+	}
+
 	if inv.Code > 0 {
 		return Error{
 			ExitCode: inv.Code,
+			Stderr:   inv.Stderr,
 		}
 	}
 
@@ -109,6 +140,40 @@ func AssertSchedulerHasSingleJob(t *testing.T, s *Scheduler) bool {
 	return true
 }
 
+// RunScheduledJobs synchronously runs all jobs registered with the cron
+// scheduler of s, regardless of their schedule.
+func RunScheduledJobs(t *testing.T, s *Scheduler) {
+	t.Helper()
+
+	for _, e := range s.cron.Entries() {
+		e.Job.Run()
+	}
+}
+
+// RunScheduledJobsConcurrently works like RunScheduledJobs but runs each
+// job in its own goroutine. It returns once all jobs returned.
+func RunScheduledJobsConcurrently(t *testing.T, s *Scheduler) {
+	t.Helper()
+
+	var wg sync.WaitGroup
+	for _, e := range s.cron.Entries() {
+		wg.Add(1)
+		go func(j cron.Job) {
+			defer wg.Done()
+			j.Run()
+		}(e.Job)
+	}
+	wg.Wait()
+}
+
+// ReadDataSubset returns the subset passed to WithReadDataSubset in os.
+func ReadDataSubset(os ...Option) string {
+	var opts options
+
+	opts.apply(os)
+	return opts.ReadDataSubset
+}
+
 // MatchOptions returns a matcher for restic options.
 //
 // The t argument is used for logging only and does not influence the test.
@@ -131,3 +196,33 @@ func MatchOptions(t *testing.T, expected ...Option) interface{} {
 		return true
 	}
 }
+
+// MatchPipelineSteps returns a matcher for pipeline steps.
+//
+// The t argument is used for logging only and does not influence the test.
+func MatchPipelineSteps(t *testing.T, expected ...PipelineStep) interface{} {
+	return func(actual []PipelineStep) bool {
+		if len(expected) != len(actual) {
+			t.Logf("Expected %d pipeline steps, got %d", len(expected), len(actual))
+			return false
+		}
+		for i := range expected {
+			e, a := expected[i], actual[i]
+			e.Options, a.Options = nil, nil
+			if !cmp.Equal(e, a) {
+				t.Logf("Pipeline step %d did not match expected step:\n%s", i+1, cmp.Diff(e, a))
+				return false
+			}
+			// The options of a step are incomplete without the options of
+			// the pipeline. Hence they are not validated.
+			var eo, ao options
+			eo.apply(expected[i].Options)
+			ao.apply(actual[i].Options)
+			if !cmp.Equal(eo, ao) {
+				t.Logf("Options of pipeline step %d did not match:\n%s", i+1, cmp.Diff(eo, ao))
+				return false
+			}
+		}
+		return true
+	}
+}
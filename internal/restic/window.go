@@ -0,0 +1,389 @@
+package restic
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// maxWindowSteps limits the number of windows Windows.nextAllowed skips
+// while looking for the next time a job may run.
+const maxWindowSteps = 100
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Window is a period of time used to restrict when a job may run. A Window
+// is either recurring or absolute.
+//
+// Recurring windows start at Start and end at End on each of Days, or on
+// every day if Days is empty. Start and End are offsets since midnight in
+// the time zone of the job. If End is not after Start the window ends on
+// the following day. A window with neither Start nor End spans the whole
+// day.
+//
+// Absolute windows start at From and end at Until.
+//
+// The text representation of a recurring window consists of the days and
+// the time range, e.g. "mon-fri 09:00-17:00", "sat,sun", or "22:00-06:00".
+// Absolute windows are represented by two RFC 3339 timestamps separated by
+// a slash, e.g. "2023-12-24T00:00:00Z/2023-12-27T00:00:00Z".
+type Window struct {
+	Days       []time.Weekday
+	Start, End time.Duration
+
+	From, Until time.Time
+}
+
+// ParseWindow parses the text representation of a Window.
+func ParseWindow(text string) (Window, error) {
+	var w Window
+
+	err := w.UnmarshalText([]byte(text))
+	return w, err
+}
+
+// UnmarshalText parses the text representation of a Window.
+func (w *Window) UnmarshalText(text []byte) error {
+	s := strings.TrimSpace(string(text))
+	if from, until, ok := strings.Cut(s, "/"); ok {
+		return w.parseAbsolute(s, from, until)
+	}
+
+	var res Window
+	fields := strings.Fields(s)
+	if len(fields) == 0 || len(fields) > 2 {
+		return fmt.Errorf("window %q: expected days, a time range, or both", s)
+	}
+	if strings.Contains(fields[len(fields)-1], ":") {
+		start, end, err := parseTimeRange(fields[len(fields)-1])
+		if err != nil {
+			return fmt.Errorf("window %q: %v", s, err)
+		}
+		res.Start, res.End = start, end
+		fields = fields[:len(fields)-1]
+	}
+	if len(fields) == 1 {
+		days, err := parseDays(fields[0])
+		if err != nil {
+			return fmt.Errorf("window %q: %v", s, err)
+		}
+		res.Days = days
+	}
+	if len(fields) > 1 {
+		return fmt.Errorf("window %q: expected days, a time range, or both", s)
+	}
+	*w = res
+	return nil
+}
+
+func (w *Window) parseAbsolute(s, from, until string) error {
+	f, err := time.Parse(time.RFC3339, from)
+	if err != nil {
+		return fmt.Errorf("window %q: %v", s, err)
+	}
+	u, err := time.Parse(time.RFC3339, until)
+	if err != nil {
+		return fmt.Errorf("window %q: %v", s, err)
+	}
+	if !u.After(f) {
+		return fmt.Errorf("window %q: end not after start", s)
+	}
+	*w = Window{From: f, Until: u}
+	return nil
+}
+
+func parseTimeRange(s string) (time.Duration, time.Duration, error) {
+	start, end, ok := strings.Cut(s, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid time range: %q", s)
+	}
+	st, err := parseTimeOfDay(start)
+	if err != nil {
+		return 0, 0, err
+	}
+	et, err := parseTimeOfDay(end)
+	if err != nil {
+		return 0, 0, err
+	}
+	return st, et, nil
+}
+
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day: %q", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func parseDays(s string) ([]time.Weekday, error) {
+	var days []time.Weekday
+
+	for _, item := range strings.Split(s, ",") {
+		first, last, isRange := strings.Cut(item, "-")
+		fd, ok := weekdayNames[strings.ToLower(first)]
+		if !ok {
+			return nil, fmt.Errorf("unknown day: %q", first)
+		}
+		if !isRange {
+			days = append(days, fd)
+			continue
+		}
+		ld, ok := weekdayNames[strings.ToLower(last)]
+		if !ok {
+			return nil, fmt.Errorf("unknown day: %q", last)
+		}
+		for d := fd; ; d = (d + 1) % 7 {
+			days = append(days, d)
+			if d == ld {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// String returns the text representation of w.
+func (w Window) String() string {
+	if w.absolute() {
+		return w.From.Format(time.RFC3339) + "/" + w.Until.Format(time.RFC3339)
+	}
+
+	var parts []string
+	if len(w.Days) > 0 {
+		days := make([]string, len(w.Days))
+		for i, d := range w.Days {
+			days[i] = strings.ToLower(d.String()[:3])
+		}
+		parts = append(parts, strings.Join(days, ","))
+	}
+	if w.Start != 0 || w.End != 0 || len(parts) == 0 {
+		parts = append(parts, formatTimeOfDay(w.Start)+"-"+formatTimeOfDay(w.End))
+	}
+	return strings.Join(parts, " ")
+}
+
+func formatTimeOfDay(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+}
+
+// Validate checks if w contains valid values.
+func (w Window) Validate() error {
+	if w.absolute() {
+		if w.From.IsZero() || w.Until.IsZero() || !w.Until.After(w.From) {
+			return fmt.Errorf("window %s: invalid date range", w)
+		}
+		return nil
+	}
+	if w.Start < 0 || w.Start >= 24*time.Hour || w.End < 0 || w.End >= 24*time.Hour {
+		return fmt.Errorf("window %s: time of day out of range", w)
+	}
+	return nil
+}
+
+func (w Window) absolute() bool {
+	return !w.From.IsZero() || !w.Until.IsZero()
+}
+
+// occurrence returns the start and end of the occurrence of the recurring
+// window w on the day of t in loc. ok is false if w does not occur on that
+// day.
+func (w Window) occurrence(t time.Time, loc *time.Location) (start, end time.Time, ok bool) {
+	t = t.In(loc)
+	if len(w.Days) > 0 {
+		for _, d := range w.Days {
+			ok = ok || d == t.Weekday()
+		}
+		if !ok {
+			return time.Time{}, time.Time{}, false
+		}
+	}
+
+	y, m, d := t.Date()
+	start = timeOfDay(y, m, d, w.Start, loc)
+	endDay := d
+	if w.End <= w.Start {
+		endDay++
+	}
+	end = timeOfDay(y, m, endDay, w.End, loc)
+	return start, end, true
+}
+
+// timeOfDay returns the time of day tod on the passed date in loc. Unlike
+// adding tod to midnight this respects changes to daylight saving time.
+func timeOfDay(y int, m time.Month, d int, tod time.Duration, loc *time.Location) time.Time {
+	return time.Date(y, m, d, int(tod/time.Hour), int(tod%time.Hour/time.Minute), 0, 0, loc)
+}
+
+// containing returns the end of the occurrence of w containing t. ok is
+// false if t is not within w.
+func (w Window) containing(t time.Time, loc *time.Location) (end time.Time, ok bool) {
+	if w.absolute() {
+		return w.Until, !t.Before(w.From) && t.Before(w.Until)
+	}
+	// An occurrence may have started on the previous day.
+	lt := t.In(loc)
+	for _, day := range []time.Time{lt.AddDate(0, 0, -1), lt} {
+		s, e, ok := w.occurrence(day, loc)
+		if ok && !t.Before(s) && t.Before(e) {
+			return e, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// nextStart returns the start of the first occurrence of w starting at or
+// after t. ok is false if there is none.
+func (w Window) nextStart(t time.Time, loc *time.Location) (start time.Time, ok bool) {
+	if w.absolute() {
+		return w.From, !w.From.Before(t)
+	}
+	lt := t.In(loc)
+	for i := 0; i <= 7; i++ {
+		s, _, ok := w.occurrence(lt.AddDate(0, 0, i), loc)
+		if ok && !s.Before(t) {
+			return s, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Windows restricts when a job may run.
+//
+// If Allowed is not empty jobs only run within any of the allowed windows.
+// Jobs never run within any of the Blocked windows. Runs which become due
+// outside of the allowed windows or within a blocked window are skipped,
+// unless Defer is set. In this case they are deferred until the next time
+// the job may run. Runs which are still in progress once the allowed window
+// ends or a blocked window starts are interrupted. Allowed windows starting
+// right where another one ends, e.g. on consecutive days, do not interrupt
+// runs.
+//
+// The zero value of Windows does not restrict a job.
+type Windows struct {
+	Allowed WindowList `yaml:"allowed"`
+	Blocked WindowList `yaml:"blocked"`
+	Defer   bool       `yaml:"defer"`
+}
+
+// Validate checks if ws contains valid values.
+func (ws Windows) Validate() error {
+	for _, w := range append(ws.Allowed[:len(ws.Allowed):len(ws.Allowed)], ws.Blocked...) {
+		if err := w.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// blocked returns true if a job may not run at t. If ws defines a time at
+// which the job may run again it is returned as next.
+func (ws Windows) blocked(t time.Time, loc *time.Location) (next time.Time, blocked bool) {
+	for _, w := range ws.Blocked {
+		if end, ok := w.containing(t, loc); ok && end.After(next) {
+			next, blocked = end, true
+		}
+	}
+	if blocked || len(ws.Allowed) == 0 {
+		return next, blocked
+	}
+	for _, w := range ws.Allowed {
+		if _, ok := w.containing(t, loc); ok {
+			return time.Time{}, false
+		}
+	}
+	for _, w := range ws.Allowed {
+		if s, ok := w.nextStart(t, loc); ok && (next.IsZero() || s.Before(next)) {
+			next = s
+		}
+	}
+	return next, true
+}
+
+// nextAllowed returns the first time at or after t a job may run. ok is
+// false if there is no such time.
+func (ws Windows) nextAllowed(t time.Time, loc *time.Location) (time.Time, bool) {
+	for i := 0; i < maxWindowSteps; i++ {
+		next, blocked := ws.blocked(t, loc)
+		if !blocked {
+			return t, true
+		}
+		if next.IsZero() {
+			return time.Time{}, false
+		}
+		t = next
+	}
+	return time.Time{}, false
+}
+
+// deadline returns the time a run starting at t needs to be completed by.
+// This is either the end of the allowed windows containing t or the start
+// of the next blocked window, whichever comes first. Allowed windows
+// starting right where the current one ends extend the deadline. ok is
+// false if there is no deadline.
+func (ws Windows) deadline(t time.Time, loc *time.Location) (deadline time.Time, ok bool) {
+	for _, w := range ws.Blocked {
+		if s, in := w.nextStart(t, loc); in && (!ok || s.Before(deadline)) {
+			deadline, ok = s, true
+		}
+	}
+	end, in := ws.allowedEnd(t, loc)
+	for i := 0; in && i < maxWindowSteps; i++ {
+		if ok && !end.Before(deadline) {
+			return deadline, ok
+		}
+		next, cont := ws.allowedEnd(end, loc)
+		if !cont {
+			return end, true
+		}
+		end = next
+	}
+	// Either there are no allowed windows, or they do not end before the
+	// blocked window, if any, starts.
+	return deadline, ok
+}
+
+// allowedEnd returns the latest end of the allowed windows containing t.
+// ok is false if no allowed window contains t.
+func (ws Windows) allowedEnd(t time.Time, loc *time.Location) (end time.Time, ok bool) {
+	for _, w := range ws.Allowed {
+		if e, in := w.containing(t, loc); in && e.After(end) {
+			end, ok = e, true
+		}
+	}
+	return end, ok
+}
+
+// WindowList is a list of windows. It implements flag.Value, which allows
+// to pass several windows using the same flag.
+type WindowList []Window
+
+// String returns the text representation of all windows in l.
+func (l *WindowList) String() string {
+	if l == nil {
+		return ""
+	}
+	s := make([]string, len(*l))
+	for i, w := range *l {
+		s[i] = w.String()
+	}
+	return strings.Join(s, "; ")
+}
+
+// Set parses the text representation of a Window and adds it to l.
+func (l *WindowList) Set(text string) error {
+	w, err := ParseWindow(text)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, w)
+	return nil
+}
@@ -0,0 +1,269 @@
+package restic
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseWindow(t *testing.T) {
+	tests := []struct {
+		text      string
+		expected  Window
+		str       string
+		assertErr assert.ErrorAssertionFunc
+	}{
+		{
+			text: "mon-fri 09:00-17:30",
+			expected: Window{
+				Days:  []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+				Start: 9 * time.Hour,
+				End:   17*time.Hour + 30*time.Minute,
+			},
+			str: "mon,tue,wed,thu,fri 09:00-17:30",
+		},
+		{
+			text:     "Sat,sun",
+			expected: Window{Days: []time.Weekday{time.Saturday, time.Sunday}},
+			str:      "sat,sun",
+		},
+		{
+			text:     "fri-mon",
+			expected: Window{Days: []time.Weekday{time.Friday, time.Saturday, time.Sunday, time.Monday}},
+			str:      "fri,sat,sun,mon",
+		},
+		{
+			text:     "22:00-06:00",
+			expected: Window{Start: 22 * time.Hour, End: 6 * time.Hour},
+			str:      "22:00-06:00",
+		},
+		{
+			text: "2023-12-24T00:00:00Z/2023-12-27T00:00:00Z",
+			expected: Window{
+				From:  time.Date(2023, 12, 24, 0, 0, 0, 0, time.UTC),
+				Until: time.Date(2023, 12, 27, 0, 0, 0, 0, time.UTC),
+			},
+			str: "2023-12-24T00:00:00Z/2023-12-27T00:00:00Z",
+		},
+		{text: "", assertErr: assert.Error},
+		{text: "someday", assertErr: assert.Error},
+		{text: "mon 25:00-06:00", assertErr: assert.Error},
+		{text: "mon 09:00", assertErr: assert.Error},
+		{text: "mon tue 09:00-10:00", assertErr: assert.Error},
+		{text: "2023-12-27T00:00:00Z/2023-12-24T00:00:00Z", assertErr: assert.Error},
+		{text: "2023-12-24/2023-12-27", assertErr: assert.Error},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.text, func(t *testing.T) {
+			w, err := ParseWindow(tt.text)
+			if tt.assertErr != nil {
+				tt.assertErr(t, err)
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, tt.expected, w)
+			assert.Equal(t, tt.str, w.String())
+		})
+	}
+}
+
+func TestWindows(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if !assert.NoError(t, err) {
+		return
+	}
+	at := func(day, hour, min int) time.Time {
+		// 2023-05-08 is a Monday.
+		return time.Date(2023, 5, 8+day, hour, min, 0, 0, loc)
+	}
+	parse := func(texts ...string) WindowList {
+		var l WindowList
+		for _, text := range texts {
+			if err := l.Set(text); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return l
+	}
+
+	tests := []struct {
+		name        string
+		windows     Windows
+		now         time.Time
+		nextAllowed time.Time
+		noNext      bool
+
+		// deadline of a run starting at nextAllowed.
+		deadline time.Time
+	}{
+		{
+			name: "no windows",
+			now:  at(0, 12, 0),
+		},
+		{
+			name:        "within allowed window",
+			windows:     Windows{Allowed: parse("mon-fri 22:00-06:00")},
+			now:         at(0, 23, 0),
+			nextAllowed: at(0, 23, 0),
+			deadline:    at(1, 6, 0),
+		},
+		{
+			name:        "within allowed window started the previous day",
+			windows:     Windows{Allowed: parse("mon-fri 22:00-06:00")},
+			now:         at(1, 5, 0),
+			nextAllowed: at(1, 5, 0),
+			deadline:    at(1, 6, 0),
+		},
+		{
+			name:        "before allowed window",
+			windows:     Windows{Allowed: parse("mon-fri 22:00-06:00")},
+			now:         at(0, 12, 0),
+			nextAllowed: at(0, 22, 0),
+			deadline:    at(1, 6, 0),
+		},
+		{
+			name:        "allowed window on next weekday",
+			windows:     Windows{Allowed: parse("mon-fri 22:00-06:00")},
+			now:         at(5, 12, 0),
+			nextAllowed: at(7, 22, 0),
+			deadline:    at(8, 6, 0),
+		},
+		{
+			name:        "within blocked window",
+			windows:     Windows{Blocked: parse("09:00-17:00")},
+			now:         at(0, 12, 0),
+			nextAllowed: at(0, 17, 0),
+			deadline:    at(1, 9, 0),
+		},
+		{
+			name:        "blocked window starts during run",
+			windows:     Windows{Blocked: parse("09:00-17:00")},
+			now:         at(0, 8, 0),
+			nextAllowed: at(0, 8, 0),
+			deadline:    at(0, 9, 0),
+		},
+		{
+			name:        "blocked window ends outside of allowed window",
+			windows:     Windows{Allowed: parse("18:00-22:00"), Blocked: parse("sat,sun")},
+			now:         at(5, 19, 0),
+			nextAllowed: at(7, 18, 0),
+			deadline:    at(7, 22, 0),
+		},
+		{
+			name: "blocked window before end of allowed window",
+			windows: Windows{
+				Allowed: parse("22:00-06:00"),
+				Blocked: parse("2023-05-09T02:00:00+02:00/2023-05-09T04:00:00+02:00"),
+			},
+			now:         at(0, 23, 0),
+			nextAllowed: at(0, 23, 0),
+			deadline:    at(1, 2, 0),
+		},
+		{
+			name:        "allowed days across midnight",
+			windows:     Windows{Allowed: parse("mon-fri")},
+			now:         at(0, 23, 0),
+			nextAllowed: at(0, 23, 0),
+			deadline:    at(5, 0, 0),
+		},
+		{
+			name:        "allowed time range across midnight into next allowed day",
+			windows:     Windows{Allowed: parse("mon-fri 20:00-00:00", "tue 00:00-02:00")},
+			now:         at(0, 23, 0),
+			nextAllowed: at(0, 23, 0),
+			deadline:    at(1, 2, 0),
+		},
+		{
+			name:        "back-to-back allowed windows",
+			windows:     Windows{Allowed: parse("00:00-12:00", "12:00-00:00")},
+			now:         at(0, 11, 0),
+			nextAllowed: at(0, 11, 0),
+		},
+		{
+			name: "back-to-back allowed windows until blocked window",
+			windows: Windows{
+				Allowed: parse("00:00-12:00", "12:00-00:00"),
+				Blocked: parse("wed 03:00-04:00"),
+			},
+			now:         at(0, 11, 0),
+			nextAllowed: at(0, 11, 0),
+			deadline:    at(2, 3, 0),
+		},
+		{
+			name:    "allowed window in the past",
+			windows: Windows{Allowed: parse("2023-05-01T00:00:00Z/2023-05-02T00:00:00Z")},
+			now:     at(0, 12, 0),
+			noNext:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			next, ok := tt.windows.nextAllowed(tt.now, loc)
+			if tt.noNext {
+				assert.False(t, ok)
+				return
+			}
+			if !assert.True(t, ok) {
+				return
+			}
+			if tt.nextAllowed.IsZero() {
+				tt.nextAllowed = tt.now
+			}
+			assert.True(t, tt.nextAllowed.Equal(next), "Expected next allowed time %v; got %v", tt.nextAllowed, next)
+
+			deadline, ok := tt.windows.deadline(next, loc)
+			assert.Equal(t, !tt.deadline.IsZero(), ok)
+			assert.True(t, tt.deadline.Equal(deadline), "Expected deadline %v; got %v", tt.deadline, deadline)
+		})
+	}
+}
+
+func TestWindow_Occurrence_DST(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	tests := []struct {
+		name       string
+		window     string
+		day        time.Time
+		start, end time.Time
+	}{
+		{
+			name:   "start of daylight saving time",
+			window: "03:00-05:00",
+			day:    time.Date(2026, 3, 29, 12, 0, 0, 0, loc),
+			start:  time.Date(2026, 3, 29, 3, 0, 0, 0, loc),
+			end:    time.Date(2026, 3, 29, 5, 0, 0, 0, loc),
+		},
+		{
+			name:   "end of daylight saving time",
+			window: "22:00-06:00",
+			day:    time.Date(2026, 10, 24, 12, 0, 0, 0, loc),
+			start:  time.Date(2026, 10, 24, 22, 0, 0, 0, loc),
+			end:    time.Date(2026, 10, 25, 6, 0, 0, 0, loc),
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := ParseWindow(tt.window)
+			if !assert.NoError(t, err) {
+				return
+			}
+			start, end, ok := w.occurrence(tt.day, loc)
+			assert.True(t, ok)
+			assert.True(t, tt.start.Equal(start), "Expected start %v; got %v", tt.start, start)
+			assert.True(t, tt.end.Equal(end), "Expected end %v; got %v", tt.end, end)
+		})
+	}
+}
@@ -2,33 +2,63 @@ package main
 
 import (
 	"fmt"
+	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
 
+	// Embed the time zone database. The Docker image does not contain it.
+	_ "time/tzdata"
+
 	"github.com/fhofherr/rsched/internal/cmd"
 	"github.com/fhofherr/rsched/internal/restic"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "healthcheck" {
+		os.Exit(cmd.Healthcheck(os.Args[2:]))
+	}
+
 	cfg, err := cmd.LoadConfig(os.Args[1:])
 	if err != nil {
 		fmt.Printf("\n%v\n", err)
-		os.Exit(1)
+		os.Exit(cmd.ExitConfigError)
+	}
+	slog.SetDefault(cmd.NewLogger(cfg, os.Stderr))
+
+	var state *restic.State
+	if cfg.StateFile != "" {
+		if state, err = restic.LoadState(cfg.StateFile); err != nil {
+			slog.Error("Failed to load state", "error", err)
+			os.Exit(cmd.ExitConfigError)
+		}
 	}
 	rsched := &cmd.RSched{
-		Scheduler: &restic.Scheduler{},
+		Scheduler: &restic.Scheduler{
+			Metrics:         restic.NewMetrics(prometheus.DefaultRegisterer),
+			ShutdownTimeout: cfg.ShutdownTimeout,
+			State:           state,
+			CatchUpWindow:   cfg.CatchUpWindow,
+		},
 	}
-	onSignal(rsched.Shutdown, syscall.SIGINT, syscall.SIGTERM)
-	rsched.Run(cfg)
+	onSignal(rsched.Shutdown, rsched.Kill, syscall.SIGINT, syscall.SIGTERM)
+	os.Exit(rsched.Run(cfg))
 }
 
-func onSignal(f func(), sigs ...os.Signal) {
-	sigc := make(chan os.Signal, 1)
+// onSignal calls shutdown once any of sigs is received. If another signal
+// is received afterwards kill is called and rsched exits immediately.
+func onSignal(shutdown, kill func(), sigs ...os.Signal) {
+	sigc := make(chan os.Signal, 2)
 
 	go func() {
 		<-sigc
-		f()
+		go shutdown()
+
+		<-sigc
+		slog.Warn("Received second signal, terminating immediately")
+		kill()
+		os.Exit(cmd.ExitFailure)
 	}()
 
 	signal.Notify(sigc, sigs...)